@@ -7,6 +7,8 @@ func Run() {
 	RootCmd.AddCommand(ExportMechCmd)
 	RootCmd.AddCommand(ParseCmd)
 	RootCmd.AddCommand(ImportCmd)
+	RootCmd.AddCommand(SyncCmd)
+	ImportCmd.AddCommand(ImportApplyCmd)
 	RootCmd.AddCommand(LintCmd)
 	RootCmd.Execute()
 }
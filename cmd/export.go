@@ -13,7 +13,7 @@ import (
 )
 
 func makeFilename(desc export.Description) string {
-	return fmt.Sprintf("%s.wiki", desc.Id)
+	return fmt.Sprintf("%s.wiki", export.EncodeTitle(desc.Id))
 }
 
 var LintCmd = &cobra.Command{
@@ -23,7 +23,7 @@ var LintCmd = &cobra.Command{
 		modDirectory := args[0]
 
 		// walk the mod directory
-		_, errs := export.WalkModsDirectory(modDirectory)
+		_, errs := export.WalkModsDirectory(modDirectory, flagIncludeDisabled)
 		if len(errs) > 0 {
 			fmt.Printf("%d errors when parsing mods", len(errs))
 			os.Exit(1)
@@ -31,185 +31,168 @@ var LintCmd = &cobra.Command{
 	},
 }
 
-var ExportCmd = &cobra.Command{
-	Use:   "export <mod directory> <destination>",
-	Short: "export all mod data to wikitext",
-	RunE: func(cmd *cobra.Command, args []string) error {
-		modDirectory := args[0]
-		destination := args[1]
-		mods, _ := export.WalkModsDirectory(modDirectory)
-
-		for _, mod := range mods {
-			for variant, mech := range mod.Mechs {
-				blacklisted := false
-				for _, tag := range mech.Mech.MechTags.Items {
-					if tag == "BLACKLISTED" {
-						blacklisted = true
-					}
-				}
-				if blacklisted {
-					logrus.Infof("Skipping BLACKLISTED mech %s", mech.Chassis.Description.Name)
-					continue
-				}
-
-				filename := fmt.Sprintf("MechDef_%s.wiki", variant)
-
-				logrus.Debugf("Writing mech wiki %s", filename)
+// exportFile is a single page of the export: the name of the file it is
+// written to, its wikitext, and the mod it came from.
+type exportFile struct {
+	Filename string
+	Content  string
+	Source   export.PageSource
+}
 
-				path := filepath.Join(destination, filename)
+// exportFiles builds the wikitext of every page in the mods, leaving out
+// anything blacklisted.
+func exportFiles(mods []export.ModData) []exportFile {
+	files := []exportFile{}
 
-				file, err := os.Create(path)
-				if err != nil {
-					logrus.Errorf("Error opening %s: %s", path, err)
-					continue
-				}
+	for _, mod := range mods {
+		add := func(filename, content, id string) {
+			source := export.PageSource{Mod: mod.Mod, Version: mod.Version, Merged: mod.Merged[id]}
+			files = append(files, exportFile{Filename: filename, Content: content, Source: source})
+		}
 
-				wiki := mech.Chassis.ToWiki() + mech.Mech.ToWiki()
-				_, err = file.WriteString(wiki)
-				if err != nil {
-					logrus.Errorf("Error opening %s: %s", path, err)
+		for variant, mech := range mod.Mechs {
+			blacklisted := false
+			for _, tag := range mech.Mech.MechTags.Items {
+				if tag == "BLACKLISTED" {
+					blacklisted = true
 				}
-				file.Close()
+			}
+			if blacklisted {
+				logrus.Infof("Skipping BLACKLISTED mech %s", mech.Chassis.Description.Name)
+				continue
 			}
 
-			for _, gear := range mod.Gear {
-				blacklisted := false
-				for _, tag := range gear.ComponentTags.Items {
-					if tag == "BLACKLISTED" {
-						blacklisted = true
-						break
-					}
-				}
-
-				if strings.HasPrefix(gear.Description.Id, "Gear_Quirk_") {
-					// quirks are never blacklisted.
-					blacklisted = false
-				}
-				if strings.Contains(mod.Mod, "BT Advanced") {
-					// nothing in the core mods is blacklisted
-					blacklisted = false
-				}
-				if strings.Contains(mod.Mod, "MechEngineer") {
-					// nothing in MechEngineer is blacklisted
-					blacklisted = false
-				}
-
-				if blacklisted {
-					logrus.Infof("Skipping BLACKLISTED gear %s", gear.Description.Id)
-					continue
-				}
-				filename := makeFilename(gear.Description)
-
-				logrus.Debugf("Writing gear wiki %s", filename)
-
-				path := filepath.Join(destination, filename)
-
-				file, err := os.Create(path)
-				if err != nil {
-					logrus.Errorf("Error opening %s: %s", path, err)
-					continue
-				}
+			filename := fmt.Sprintf("%s.wiki", export.EncodeTitle("MechDef_"+variant))
+			add(filename, mech.Chassis.ToWiki()+mech.Mech.ToWiki(), mech.Mech.Description.Id)
+		}
 
-				wiki := gear.ToWiki()
-				_, err = file.WriteString(wiki)
-				if err != nil {
-					logrus.Errorf("Error writing %s: %s", path, err)
+		for _, vehicle := range mod.Vehicles {
+			blacklisted := false
+			for _, tag := range vehicle.Vehicle.VehicleTags.Items {
+				if tag == "BLACKLISTED" {
+					blacklisted = true
 				}
-				file.Close()
 			}
+			if blacklisted {
+				logrus.Infof("Skipping BLACKLISTED vehicle %s", vehicle.Vehicle.Description.Id)
+				continue
+			}
+			add(makeFilename(vehicle.Vehicle.Description), vehicle.ToWiki(), vehicle.Vehicle.Description.Id)
+		}
 
-			for _, weapon := range mod.Weapons {
-				blacklisted := false
-				for _, tag := range weapon.ComponentTags.Items {
-					if tag == "BLACKLISTED" {
-						blacklisted = true
-					}
-				}
-				if blacklisted {
-					logrus.Infof("Skipping BLACKLISTED weapon %s", weapon.Description.Id)
-					continue
+		for _, gear := range mod.Gear {
+			blacklisted := false
+			for _, tag := range gear.ComponentTags.Items {
+				if tag == "BLACKLISTED" {
+					blacklisted = true
+					break
 				}
-				filename := makeFilename(weapon.Description)
+			}
 
-				logrus.Debugf("Writing weapon wiki %s", filename)
+			if strings.HasPrefix(gear.Description.Id, "Gear_Quirk_") {
+				// quirks are never blacklisted.
+				blacklisted = false
+			}
+			if strings.Contains(mod.Mod, "BT Advanced") {
+				// nothing in the core mods is blacklisted
+				blacklisted = false
+			}
+			if strings.Contains(mod.Mod, "MechEngineer") {
+				// nothing in MechEngineer is blacklisted
+				blacklisted = false
+			}
 
-				path := filepath.Join(destination, filename)
+			if blacklisted {
+				logrus.Infof("Skipping BLACKLISTED gear %s", gear.Description.Id)
+				continue
+			}
+			add(makeFilename(gear.Description), gear.ToWiki(), gear.Description.Id)
+		}
 
-				file, err := os.Create(path)
-				if err != nil {
-					logrus.Errorf("Error opening %s: %s", path, err)
-					continue
+		for _, weapon := range mod.Weapons {
+			blacklisted := false
+			for _, tag := range weapon.ComponentTags.Items {
+				if tag == "BLACKLISTED" {
+					blacklisted = true
 				}
+			}
+			if blacklisted {
+				logrus.Infof("Skipping BLACKLISTED weapon %s", weapon.Description.Id)
+				continue
+			}
+			add(makeFilename(weapon.Description), weapon.ToWiki(), weapon.Description.Id)
+		}
 
-				wiki := weapon.ToWiki()
-				_, err = file.WriteString(wiki)
-				if err != nil {
-					logrus.Errorf("Error writing %s: %s\n", path, err)
+		for _, jumpjet := range mod.JumpJets {
+			blacklisted := false
+			for _, tag := range jumpjet.ComponentTags.Items {
+				if tag == "BLACKLISTED" {
+					blacklisted = true
 				}
-				file.Close()
 			}
+			if blacklisted {
+				logrus.Infof("Skipping BLACKLISTED jumpjet %s", jumpjet.Description.Id)
+				continue
+			}
+			add(makeFilename(jumpjet.Description), jumpjet.ToWiki(), jumpjet.Description.Id)
+		}
 
-			for _, jumpjet := range mod.JumpJets {
-				blacklisted := false
-				for _, tag := range jumpjet.ComponentTags.Items {
-					if tag == "BLACKLISTED" {
-						blacklisted = true
-					}
+		for _, ammo := range mod.Ammo {
+			blacklisted := false
+			for _, tag := range ammo.AmmunitionBox.ComponentTags.Items {
+				if tag == "BLACKLISTED" {
+					logrus.Infof("Skipping BLACKLISTED ammo %s", ammo.AmmunitionBox.Description.Id)
+					blacklisted = true
 				}
-				if blacklisted {
-					logrus.Infof("Skipping BLACKLISTED jumpjet %s", jumpjet.Description.Id)
-					continue
-				}
-				filename := makeFilename(jumpjet.Description)
-
-				logrus.Debugf("Writing jumpjet wiki %s", filename)
-
-				path := filepath.Join(destination, filename)
+			}
+			if blacklisted {
+				continue
+			}
+			add(makeFilename(ammo.AmmunitionBox.Description), ammo.ToWiki(), ammo.AmmunitionBox.Description.Id)
+		}
+	}
 
-				file, err := os.Create(path)
-				if err != nil {
-					logrus.Errorf("Error opening %s: %s", path, err)
-					continue
-				}
+	return files
+}
 
-				wiki := jumpjet.ToWiki()
-				_, err = file.WriteString(wiki)
-				if err != nil {
-					logrus.Errorf("Error writing %s: %s", path, err)
-				}
-				file.Close()
-			}
+var ExportCmd = &cobra.Command{
+	Use:   "export <mod directory> <destination>",
+	Short: "export all mod data to wikitext",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		modDirectory := args[0]
+		destination := args[1]
+		mods, _ := export.WalkModsDirectory(modDirectory, flagIncludeDisabled)
 
-			for _, ammo := range mod.Ammo {
-				blacklisted := false
-				for _, tag := range ammo.AmmunitionBox.ComponentTags.Items {
-					if tag == "BLACKLISTED" {
-						logrus.Infof("Skipping BLACKLISTED ammo %s", ammo.AmmunitionBox.Description.Id)
-						blacklisted = true
-					}
-				}
-				if blacklisted {
-					continue
-				}
-				filename := makeFilename(ammo.AmmunitionBox.Description)
+		// remember which mod each page came from, so the import can say so
+		// in its edit summaries.
+		sources := map[string]export.PageSource{}
 
-				logrus.Debugf("Writing ammo  wiki %s\n", filename)
+		for _, page := range exportFiles(mods) {
+			logrus.Debugf("Writing wiki %s", page.Filename)
 
-				path := filepath.Join(destination, filename)
+			path := filepath.Join(destination, page.Filename)
 
-				file, err := os.Create(path)
-				if err != nil {
-					logrus.Errorf("Error opening %s: %s", path, err)
-					continue
-				}
+			file, err := os.Create(path)
+			if err != nil {
+				logrus.Errorf("Error opening %s: %s", path, err)
+				continue
+			}
 
-				wiki := ammo.ToWiki()
-				_, err = file.WriteString(wiki)
-				if err != nil {
-					logrus.Errorf("Error writing %s: %s", path, err)
-				}
-				file.Close()
+			_, err = file.WriteString(page.Content)
+			if err != nil {
+				logrus.Errorf("Error writing %s: %s", path, err)
 			}
+			file.Close()
+			sources[strings.TrimSuffix(page.Filename, ".wiki")] = page.Source
+		}
+
+		provenance := export.Provenance{
+			Commit: export.GitCommit(modDirectory),
+			Pages:  sources,
+		}
+		path := filepath.Join(destination, export.ProvenanceFile)
+		if err := provenance.Write(path); err != nil {
+			return fmt.Errorf("error writing %s: %s", path, err)
 		}
 
 		return nil
@@ -223,7 +206,7 @@ var ExportMechCmd = &cobra.Command{
 		modDirectory := args[0]
 		mechVariant := args[1]
 
-		mods, _ := export.WalkModsDirectory(modDirectory)
+		mods, _ := export.WalkModsDirectory(modDirectory, flagIncludeDisabled)
 
 		var (
 			variant export.CompleteMechDef
@@ -9,75 +9,465 @@ import (
 	"github.com/dperny/bta-wiki-import/importer"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 const (
-	USERNAME_ENV = "WIKI_USER"
-	PASSWORD_ENV = "WIKI_PASS"
+	USERNAME_ENV      = "WIKI_USER"
+	PASSWORD_ENV      = "WIKI_PASS"
+	URL_ENV           = "WIKI_URL"
+	NAMESPACE_ENV     = "WIKI_NAMESPACE"
+	GEAR_TABLE_ENV    = "WIKI_GEAR_TABLE"
+	CHASSIS_TABLE_ENV = "WIKI_CHASSIS_TABLE"
+	VEHICLE_TABLE_ENV = "WIKI_VEHICLE_TABLE"
+	AUTH_ENV          = "WIKI_AUTH"
 )
 
+// oauthEnv maps the name of each OAuth credential to the environment
+// variable it can be read from.
+var oauthEnv = map[string]string{
+	"consumer_key":    "WIKI_OAUTH_CONSUMER_KEY",
+	"consumer_secret": "WIKI_OAUTH_CONSUMER_SECRET",
+	"access_token":    "WIKI_OAUTH_ACCESS_TOKEN",
+	"access_secret":   "WIKI_OAUTH_ACCESS_SECRET",
+}
+
 var (
-	flagDryRun       bool
-	flagWikiUsername string
-	flagWikiPassFile string
+	flagDryRun           bool
+	flagWikiUsername     string
+	flagWikiPassFile     string
+	flagAuth             string
+	flagOAuthFile        string
+	flagBotEdit          bool
+	flagMinorEdit        bool
+	flagTags             []string
+	flagMaxLag           int
+	flagRefreshListings  string
+	flagWikiURL          string
+	flagWikiNamespace    string
+	flagWikiGearTable    string
+	flagWikiChassisTable string
+	flagWikiVehicleTable string
+	flagNoDelete         bool
+	flagMaxDeletions     string
+	flagForce            bool
+	flagKeepList         string
+	flagMaxAttempts      int
+	flagConcurrency      int
+	flagRate             float64
+	flagPlanOut          string
+	flagReportOut        string
+	flagOverwriteManual  bool
+	flagCrossCheckCargo  bool
+	flagModsDir          string
+	flagSummary          string
+	flagModsCommit       string
+	flagJournal          string
+	flagResume           bool
+	flagProtect          string
 )
 
+// flagOrEnv returns the flag value if it is set, and otherwise the value of
+// the given environment variable. If neither is set, the empty string is
+// returned and the importer falls back to its default.
+func flagOrEnv(flagValue, env string) string {
+	if flagValue != "" {
+		return flagValue
+	}
+	return os.Getenv(env)
+}
+
+// wikiOptions builds the importer options shared by every import command:
+// which wiki to talk to, the credentials to authenticate with, and how hard
+// to push the wiki.
+func wikiOptions() (importer.Options, error) {
+	opts := importer.Options{
+		URL:                  flagOrEnv(flagWikiURL, URL_ENV),
+		Namespace:            flagOrEnv(flagWikiNamespace, NAMESPACE_ENV),
+		DryRun:               flagDryRun,
+		Retry:                importer.RetryPolicy{MaxAttempts: flagMaxAttempts},
+		Concurrency:          flagConcurrency,
+		RequestsPerSecond:    flagRate,
+		ReportOut:            flagReportOut,
+		OverwriteManualEdits: flagOverwriteManual,
+		Summary:              flagSummary,
+		BotEdit:              flagBotEdit,
+		MinorEdit:            flagMinorEdit,
+		Tags:                 flagTags,
+		MaxLag:               flagMaxLag,
+		RefreshListings:      flagRefreshListings,
+	}
+
+	switch flagRefreshListings {
+	case "", importer.RefreshPurge, importer.RefreshNullEdit:
+	default:
+		return opts, fmt.Errorf(
+			"unknown --refresh-listings %q, must be %s or %s",
+			flagRefreshListings, importer.RefreshPurge, importer.RefreshNullEdit,
+		)
+	}
+
+	var err error
+	switch auth := flagOrEnv(flagAuth, AUTH_ENV); auth {
+	case "", "password":
+		opts.Username, opts.Password, err = passwordCredentials()
+	case "oauth1":
+		opts.OAuth1, err = oauth1Credentials()
+	case "oauth2":
+		opts.OAuth2Token, err = oauth2Credentials()
+	default:
+		err = fmt.Errorf("unknown auth mode %q, must be password, oauth1 or oauth2", auth)
+	}
+	return opts, err
+}
+
+// passwordCredentials returns the username and password to log in with. The
+// username may be a bot password's "User@botname", with the bot password as
+// the password.
+func passwordCredentials() (string, string, error) {
+	// first, check the flags for a username. Prefer this over the
+	// environment variable.
+	username := flagWikiUsername
+
+	// if there is no username flag set, then check the environment
+	if flagWikiUsername == "" {
+		if user := os.Getenv(USERNAME_ENV); user != "" {
+			username = user
+		} else if !flagDryRun {
+			// if there is no username provided, we can still do a dry run
+			// on the public wiki
+			return "", "", fmt.Errorf("no wiki username provided")
+		}
+	}
+
+	password := ""
+	// again, first check to see if the password is in a file provided by
+	// flags.
+	passFile := flagWikiPassFile
+	// if the passfile is not empty, open and read that file, trimming off
+	// spaces
+	if flagWikiPassFile != "" {
+		fileContents, err := ioutil.ReadFile(passFile)
+		if err != nil {
+			return "", "", err
+		}
+		password = strings.TrimSpace(string(fileContents))
+	} else {
+		password = os.Getenv(PASSWORD_ENV)
+	}
+
+	if password == "" && !flagDryRun {
+		return "", "", fmt.Errorf("no wiki password provided")
+	}
+
+	return username, password, nil
+}
+
+// oauthSecrets returns the OAuth credentials from the file given by
+// --oauth-file, falling back to the environment for any the file does not
+// have. The file holds one "name=value" pair per line, with the names
+// consumer_key, consumer_secret, access_token and access_secret.
+func oauthSecrets() (map[string]string, error) {
+	secrets := map[string]string{}
+	if flagOAuthFile != "" {
+		fileContents, err := ioutil.ReadFile(flagOAuthFile)
+		if err != nil {
+			return nil, err
+		}
+		for i, line := range strings.Split(string(fileContents), "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			parts := strings.SplitN(line, "=", 2)
+			if len(parts) != 2 {
+				return nil, fmt.Errorf("%s:%d: expected name=value", flagOAuthFile, i+1)
+			}
+			secrets[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+		}
+	}
+
+	for name, env := range oauthEnv {
+		if secrets[name] == "" {
+			secrets[name] = os.Getenv(env)
+		}
+	}
+	return secrets, nil
+}
+
+// oauth1Credentials returns the keys of an OAuth 1.0a owner-only consumer.
+func oauth1Credentials() (*importer.OAuth1Credentials, error) {
+	secrets, err := oauthSecrets()
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range []string{"consumer_key", "consumer_secret", "access_token", "access_secret"} {
+		if secrets[name] != "" {
+			continue
+		}
+		if flagDryRun {
+			// a dry run can still read the public wiki.
+			return nil, nil
+		}
+		return nil, fmt.Errorf("no oauth %s provided", name)
+	}
+	return &importer.OAuth1Credentials{
+		ConsumerKey:    secrets["consumer_key"],
+		ConsumerSecret: secrets["consumer_secret"],
+		AccessToken:    secrets["access_token"],
+		AccessSecret:   secrets["access_secret"],
+	}, nil
+}
+
+// oauth2Credentials returns the access token of an OAuth 2.0 owner-only
+// consumer.
+func oauth2Credentials() (string, error) {
+	secrets, err := oauthSecrets()
+	if err != nil {
+		return "", err
+	}
+	if secrets["access_token"] == "" && !flagDryRun {
+		return "", fmt.Errorf("no oauth access_token provided")
+	}
+	return secrets["access_token"], nil
+}
+
+// deletionOptions sets the options that guard against deleting pages, which
+// apply both to imports and to plans made by one.
+func deletionOptions(opts *importer.Options) error {
+	maxDeletions, err := importer.ParseDeletionLimit(flagMaxDeletions)
+	if err != nil {
+		return err
+	}
+
+	var allowlist map[string]bool
+	if flagKeepList != "" {
+		allowlist, err = importer.LoadAllowlist(flagKeepList)
+		if err != nil {
+			return err
+		}
+	}
+
+	opts.NoDelete = flagNoDelete
+	opts.MaxDeletions = maxDeletions
+	opts.Force = flagForce
+	opts.Allowlist = allowlist
+	return nil
+}
+
+// importOptions builds the importer options for commands that import a
+// whole export: the wiki options, and which pages may be changed.
+func importOptions() (importer.Options, error) {
+	opts, err := wikiOptions()
+	if err != nil {
+		return opts, err
+	}
+	if err := deletionOptions(&opts); err != nil {
+		return opts, err
+	}
+
+	opts.GearTable = flagOrEnv(flagWikiGearTable, GEAR_TABLE_ENV)
+	opts.ChassisTable = flagOrEnv(flagWikiChassisTable, CHASSIS_TABLE_ENV)
+	opts.VehicleTable = flagOrEnv(flagWikiVehicleTable, VEHICLE_TABLE_ENV)
+	opts.CrossCheckCargo = flagCrossCheckCargo
+	opts.PlanOut = flagPlanOut
+	opts.ModsCommit = flagModsCommit
+	opts.Journal = flagJournal
+	opts.Resume = flagResume
+	opts.Protect = flagProtect
+	return opts, nil
+}
+
 var ImportCmd = &cobra.Command{
 	Use:   "import <wikidata>",
 	Short: "import mod data to wiki",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		// first, check the flags for a username. Prefer this over the
-		// environment variable.
-		username := flagWikiUsername
-
-		// if there is no username flag set, then check the environment
-		if flagWikiUsername == "" {
-			if user := os.Getenv(USERNAME_ENV); user != "" {
-				username = user
-			} else if !flagDryRun {
-				// if there is no username provided, we can still do a dry run
-				// on the public wiki
-				return fmt.Errorf("no wiki username provided")
-			}
+		opts, err := importOptions()
+		if err != nil {
+			return err
 		}
+		opts.ModsDir = flagModsDir
 
-		password := ""
-		// again, first check to see if the password is in a file provided by
-		// flags.
-		passFile := flagWikiPassFile
-		// if the passfile is not empty, open and read that file, trimming off
-		// spaces
-		if flagWikiPassFile != "" {
-			fileContents, err := ioutil.ReadFile(passFile)
-			if err != nil {
-				return err
-			}
-			password = strings.TrimSpace(string(fileContents))
-		} else {
-			password = os.Getenv(PASSWORD_ENV)
+		return importer.Import(args[0], opts)
+	},
+}
+
+var ImportApplyCmd = &cobra.Command{
+	Use:   "apply <plan.json>",
+	Short: "make exactly the changes in a plan written by import --plan-out",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		plan, err := importer.LoadPlan(args[0])
+		if err != nil {
+			return err
 		}
 
-		if password == "" && !flagDryRun {
-			return fmt.Errorf("no wiki password provided")
+		opts, err := wikiOptions()
+		if err != nil {
+			return err
+		}
+		// the plan may have been written by a dry run that only warned
+		// about its deletions, so they are checked again.
+		if err := deletionOptions(&opts); err != nil {
+			return err
 		}
 
-		return importer.Import(args[0], flagDryRun, username, password)
+		return importer.Apply(plan, opts)
 	},
 }
 
-func init() {
-	ImportCmd.Flags().BoolVarP(
+// addWikiFlags adds the flags that say which wiki to talk to and how to
+// treat it, which every command that writes to the wiki shares.
+func addWikiFlags(flags *pflag.FlagSet) {
+	flags.BoolVarP(
 		&flagDryRun, "dry-run", "d", false,
 		"do a dry run, checking data but making no changes to the wiki",
 	)
-	ImportCmd.Flags().StringVarP(
+	flags.StringVarP(
 		&flagWikiUsername, "username", "u", "",
-		"the username to use when logging into the wiki",
+		"the username to use when logging into the wiki, or User@botname to use a bot password",
 	)
-	ImportCmd.Flags().StringVar(
+	flags.StringVar(
 		&flagWikiPassFile, "passfile", "",
-		"a file to read the wiki password from",
+		"a file to read the wiki password or bot password from",
+	)
+	flags.StringVar(
+		&flagAuth, "auth", "",
+		"how to authenticate with the wiki: password, oauth1 or oauth2 (default password)",
+	)
+	flags.StringVar(
+		&flagOAuthFile, "oauth-file", "",
+		"a file of name=value lines to read the oauth consumer_key, consumer_secret, access_token and access_secret from",
+	)
+	flags.StringVar(
+		&flagWikiURL, "wiki-url", "",
+		fmt.Sprintf("the api.php endpoint of the wiki (default %s)", importer.DefaultURL),
+	)
+	flags.StringVar(
+		&flagWikiNamespace, "namespace", "",
+		fmt.Sprintf("the namespace pages are written to (default %s)", importer.DefaultNamespace),
+	)
+	flags.IntVar(
+		&flagMaxAttempts, "max-attempts", importer.DefaultRetryPolicy.MaxAttempts,
+		"the number of times to try each wiki request before giving up on a page",
+	)
+	flags.IntVar(
+		&flagConcurrency, "concurrency", importer.DefaultConcurrency,
+		"the number of pages to fetch or write at once",
+	)
+	flags.Float64Var(
+		&flagRate, "rate", 5,
+		"the maximum average number of wiki requests per second, or 0 for no limit",
+	)
+	flags.StringVar(
+		&flagReportOut, "report-out", "",
+		"write the outcome of every page operation to this JSON file",
+	)
+	flags.BoolVar(
+		&flagOverwriteManual, "overwrite-manual-edits", false,
+		"change pages even if their latest revision was made by someone else",
+	)
+	flags.BoolVar(
+		&flagBotEdit, "bot", true,
+		"mark edits as bot edits, hiding them from recent changes (needs the bot right)",
+	)
+	flags.BoolVar(
+		&flagMinorEdit, "minor", false,
+		"mark edits as minor edits",
+	)
+	flags.StringSliceVar(
+		&flagTags, "tag", nil,
+		"a change tag to apply to every edit, deletion and upload; may be repeated",
+	)
+	flags.IntVar(
+		&flagMaxLag, "maxlag", 5,
+		"hold off writes while the wiki's replicas lag by more than this many seconds, or 0 to not check",
+	)
+	flags.StringVar(
+		&flagRefreshListings, "refresh-listings", "",
+		fmt.Sprintf(
+			"after importing, refresh the pages that transclude changed pages, with %s or %s",
+			importer.RefreshPurge, importer.RefreshNullEdit,
+		),
+	)
+	flags.StringVar(
+		&flagSummary, "summary", "",
+		"a message to add to the summary of every edit",
+	)
+}
+
+// addImportFlags adds the flags that control how a whole export is imported,
+// which the import and sync commands share.
+func addImportFlags(flags *pflag.FlagSet) {
+	flags.StringVar(
+		&flagWikiGearTable, "gear-table", "",
+		fmt.Sprintf("the cargo table listing existing gear (default %s)", importer.DefaultGearTable),
+	)
+	flags.StringVar(
+		&flagWikiChassisTable, "chassis-table", "",
+		fmt.Sprintf("the cargo table listing existing chassis (default %s)", importer.DefaultChassisTable),
+	)
+	flags.StringVar(
+		&flagWikiVehicleTable, "vehicle-table", "",
+		fmt.Sprintf("the cargo table listing existing vehicles (default %s)", importer.DefaultVehicleTable),
+	)
+	flags.BoolVar(
+		&flagCrossCheckCargo, "cross-check-cargo", false,
+		"warn about pages listed in the cargo tables that are missing from the namespace",
+	)
+	addDeletionFlags(flags)
+	flags.StringVar(
+		&flagModsCommit, "mods-commit", "",
+		"the git commit of the mods the export was made from, to name in edit summaries (default the commit recorded by the export)",
+	)
+	flags.StringVar(
+		&flagProtect, "protect", "",
+		"keep every page in the import namespace edit protected at this level, like autoconfirmed or sysop, and report pages found protected at another level (unprotected pages are protected without being reported, so a first run reports no drift)",
+	)
+	flags.StringVar(
+		&flagPlanOut, "plan-out", "",
+		"write every planned change, with content hashes and diffs, to this JSON file",
+	)
+	flags.StringVar(
+		&flagJournal, "journal", importer.DefaultJournal,
+		"record every completed page operation in this file, so an interrupted import can be resumed",
+	)
+	flags.BoolVar(
+		&flagResume, "resume", false,
+		"skip pages the journal records as done, unless the export has changed since",
+	)
+}
+
+// addDeletionFlags adds the flags that guard against deleting pages, which
+// every command that may delete pages shares.
+func addDeletionFlags(flags *pflag.FlagSet) {
+	flags.BoolVar(
+		&flagNoDelete, "no-delete", false,
+		"create and update pages, but never delete any",
+	)
+	flags.StringVar(
+		&flagMaxDeletions, "max-deletions", "10%",
+		"abort if more pages than this would be deleted, as a count or a percentage of existing pages",
+	)
+	flags.BoolVar(
+		&flagForce, "force", false,
+		"delete pages even if over the --max-deletions limit",
+	)
+	flags.StringVar(
+		&flagKeepList, "keep-list", "",
+		"a file of page names, one per line, that must never be deleted",
+	)
+}
+
+func init() {
+	// the wiki flags are shared with the import subcommands.
+	addWikiFlags(ImportCmd.PersistentFlags())
+	addImportFlags(ImportCmd.Flags())
+	addDeletionFlags(ImportApplyCmd.Flags())
+	ImportCmd.Flags().StringVar(
+		&flagModsDir, "mods", "",
+		"the mod directory the export was made from; if set, upload the icons it references",
 	)
-	// NEVER accept the password as a flag, which would leave the password in
-	// the user's shell history.
+	// NEVER accept the password or any oauth secret as a flag, which would
+	// leave it in the user's shell history.
 }
@@ -63,6 +63,26 @@ var ParseCmd = &cobra.Command{
 				return err
 			}
 			fmt.Println(string(d))
+		case "VehicleChassis":
+			chassis, err := export.ParseVehicleChassisDef(file)
+			if err != nil {
+				return err
+			}
+			d, err := json.MarshalIndent(chassis, "", "\t")
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(d))
+		case "Vehicle":
+			vehicle, err := export.ParseVehicleDef(file)
+			if err != nil {
+				return err
+			}
+			d, err := json.MarshalIndent(vehicle, "", "\t")
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(d))
 		}
 
 		return nil
@@ -6,8 +6,9 @@ import (
 )
 
 var (
-	flagColor bool
-	flagDebug bool
+	flagColor           bool
+	flagDebug           bool
+	flagIncludeDisabled bool
 )
 
 var RootCmd = &cobra.Command{
@@ -26,4 +27,8 @@ var RootCmd = &cobra.Command{
 func init() {
 	RootCmd.PersistentFlags().BoolVar(&flagColor, "color", true, "enable color logging")
 	RootCmd.PersistentFlags().BoolVar(&flagDebug, "debug", false, "enable debug-level logging")
+	RootCmd.PersistentFlags().BoolVar(
+		&flagIncludeDisabled, "include-disabled", false,
+		"read mods that are disabled in their mod.json, as if they were enabled",
+	)
 }
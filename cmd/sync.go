@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dperny/bta-wiki-import/export"
+	"github.com/dperny/bta-wiki-import/importer"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var flagNoImages bool
+
+var SyncCmd = &cobra.Command{
+	Use:   "sync <mod directory>",
+	Short: "export all mod data and import it to the wiki, without writing files",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		modDirectory := args[0]
+
+		opts, err := importOptions()
+		if err != nil {
+			return err
+		}
+		if !flagNoImages {
+			opts.ModsDir = modDirectory
+		}
+
+		mods, errs := export.WalkModsDirectory(modDirectory, flagIncludeDisabled)
+		if len(errs) > 0 {
+			// a page left out because its mod failed to parse would be
+			// deleted from the wiki, so refuse to go on.
+			return fmt.Errorf("%d errors when parsing mods", len(errs))
+		}
+
+		// exported pages all go in the import namespace.
+		namespace := opts.Namespace
+		if namespace == "" {
+			namespace = importer.DefaultNamespace
+		}
+
+		provenance := export.Provenance{
+			Commit: export.GitCommit(modDirectory),
+			Pages:  map[string]export.PageSource{},
+		}
+		pages := []importer.Page{}
+		for _, file := range exportFiles(mods) {
+			source := strings.TrimSuffix(file.Filename, ".wiki")
+			title, err := export.DecodeTitle(source)
+			if err != nil {
+				return err
+			}
+			pages = append(pages, importer.Page{
+				Source:    source,
+				Namespace: namespace,
+				Title:     title,
+				Content:   file.Content,
+			})
+			provenance.Pages[source] = file.Source
+		}
+		logrus.Infof("Built %d wiki pages", len(pages))
+
+		return importer.ImportPages(pages, provenance, opts)
+	},
+}
+
+func init() {
+	addWikiFlags(SyncCmd.Flags())
+	addImportFlags(SyncCmd.Flags())
+	SyncCmd.Flags().BoolVar(
+		&flagNoImages, "no-images", false,
+		"import the pages only, without uploading the icons they reference",
+	)
+}
@@ -8,16 +8,30 @@ import (
 	"github.com/dperny/bta-wiki-import/export"
 )
 
+var flagShowOrder bool
+
 var WalkCommand = &cobra.Command{
 	Use:   "walk <directory>",
 	Short: "walks a given mod directory and explains what it finds",
 	RunE: func(cmd *cobra.Command, args []string) error {
 		modDirectory := args[0]
 
-		mods, errors := export.WalkModsDirectory(modDirectory)
+		if flagShowOrder {
+			order, errors := export.ModLoadOrder(modDirectory, flagIncludeDisabled)
+			for i, mod := range order {
+				fmt.Printf("%3d. %s %s\n", i+1, mod.Name, mod.Version)
+			}
+			if len(errors) > 0 {
+				return fmt.Errorf("%d errors when ordering mods", len(errors))
+			}
+			return nil
+		}
+
+		mods, errors := export.WalkModsDirectory(modDirectory, flagIncludeDisabled)
 
 		var (
 			mechCount    int
+			vehicleCount int
 			gearCount    int
 			weaponCount  int
 			ammoCount    int
@@ -26,6 +40,7 @@ var WalkCommand = &cobra.Command{
 
 		for _, mod := range mods {
 			mechCount = mechCount + len(mod.Mechs)
+			vehicleCount = vehicleCount + len(mod.Vehicles)
 			gearCount = gearCount + len(mod.Gear)
 			weaponCount = weaponCount + len(mod.Weapons)
 			ammoCount = ammoCount + len(mod.Ammo)
@@ -33,10 +48,17 @@ var WalkCommand = &cobra.Command{
 		}
 
 		fmt.Printf(
-			"handled %d mechs, %d gear, %d jumpjets, %d weapons, %d ammunition with %d errors\n",
-			mechCount, gearCount, jumpjetCount, weaponCount, ammoCount, len(errors),
+			"handled %d mechs, %d vehicles, %d gear, %d jumpjets, %d weapons, %d ammunition with %d errors\n",
+			mechCount, vehicleCount, gearCount, jumpjetCount, weaponCount, ammoCount, len(errors),
 		)
 
 		return nil
 	},
 }
+
+func init() {
+	WalkCommand.Flags().BoolVar(
+		&flagShowOrder, "show-order", false,
+		"print the order the mods are loaded in, instead of walking them",
+	)
+}
@@ -1,7 +1,6 @@
 package export
 
 import (
-	"encoding/json"
 	"fmt"
 	"io"
 	"strings"
@@ -101,8 +100,7 @@ func (cl ChassisLocation) ToWiki(chassisID string) string {
 func ParseChassisDef(data io.Reader) (ChassisDef, error) {
 	var chassis ChassisDef
 
-	d := json.NewDecoder(data)
-	err := d.Decode(&chassis)
+	err := decodeJSON(data, &chassis)
 
 	if err == nil && chassis.Description.Id == "" {
 		return chassis, fmt.Errorf("missing Id")
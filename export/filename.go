@@ -0,0 +1,49 @@
+package export
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// unsafeFilenameChars are the characters that cannot appear in a file name on
+// some platform, or that would make the name ambiguous. '%' is included so
+// that encoded names can always be decoded.
+const unsafeFilenameChars = `%/\:*?"<>|`
+
+// EncodeTitle returns a file name for a page title. Characters that cannot
+// appear in file names, like the slashes of subpages and the colons of
+// namespaces, are percent encoded, so that DecodeTitle can get the title back.
+func EncodeTitle(title string) string {
+	var b strings.Builder
+	for i := 0; i < len(title); i++ {
+		c := title[i]
+		if c < 0x20 || strings.IndexByte(unsafeFilenameChars, c) >= 0 {
+			fmt.Fprintf(&b, "%%%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// DecodeTitle returns the page title for a file name made by EncodeTitle.
+func DecodeTitle(name string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		if name[i] != '%' {
+			b.WriteByte(name[i])
+			continue
+		}
+		if i+2 >= len(name) {
+			return "", fmt.Errorf("invalid escape at end of %q", name)
+		}
+		c, err := strconv.ParseUint(name[i+1:i+3], 16, 8)
+		if err != nil {
+			return "", fmt.Errorf("invalid escape %q in %q", name[i:i+3], name)
+		}
+		b.WriteByte(byte(c))
+		i += 2
+	}
+	return b.String(), nil
+}
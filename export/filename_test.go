@@ -0,0 +1,59 @@
+package export
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEncodeTitle(t *testing.T) {
+	for _, tc := range []struct {
+		title string
+		want  string
+	}{
+		{"Mechs", "Mechs"},
+		{"Atlas AS7-D", "Atlas AS7-D"},
+		{"Mechs/Assault", "Mechs%2FAssault"},
+		{"Category:Mechs", "Category%3AMechs"},
+		{"100% Armor", "100%25 Armor"},
+		{`What? "Why" <a|b> *c\d`, "What%3F %22Why%22 %3Ca%7Cb%3E %2Ac%5Cd"},
+		{"Tab\tName", "Tab%09Name"},
+		{"Überläufer", "Überläufer"},
+	} {
+		got := EncodeTitle(tc.title)
+		if got != tc.want {
+			t.Errorf("EncodeTitle(%q) = %q, want %q", tc.title, got, tc.want)
+		}
+		if strings.ContainsAny(got, `/\:*?"<>|`) {
+			t.Errorf("EncodeTitle(%q) = %q, which is not a safe file name", tc.title, got)
+		}
+
+		title, err := DecodeTitle(got)
+		if err != nil {
+			t.Errorf("DecodeTitle(%q) failed: %s", got, err)
+		} else if title != tc.title {
+			t.Errorf("DecodeTitle(%q) = %q, want %q", got, title, tc.title)
+		}
+	}
+}
+
+func TestDecodeTitle(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		want string
+		err  bool
+	}{
+		{"Mechs", "Mechs", false},
+		{"Mechs%2fAssault", "Mechs/Assault", false},
+		{"%25%25", "%%", false},
+		{"Mechs%", "", true},
+		{"Mechs%2", "", true},
+		{"Mechs%zz", "", true},
+	} {
+		got, err := DecodeTitle(tc.name)
+		if (err != nil) != tc.err {
+			t.Errorf("DecodeTitle(%q) got error %v, want error %v", tc.name, err, tc.err)
+		} else if got != tc.want {
+			t.Errorf("DecodeTitle(%q) = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
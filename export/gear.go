@@ -1,7 +1,6 @@
 package export
 
 import (
-	"encoding/json"
 	"fmt"
 	"io"
 	"strings"
@@ -144,8 +143,7 @@ type Category struct {
 func ParseWeapon(data io.Reader) (Weapon, error) {
 	var weapon Weapon
 
-	d := json.NewDecoder(data)
-	err := d.Decode(&weapon)
+	err := decodeJSON(data, &weapon)
 
 	if err == nil && weapon.Description.Id == "" {
 		return weapon, fmt.Errorf("missing Id")
@@ -157,8 +155,7 @@ func ParseWeapon(data io.Reader) (Weapon, error) {
 func ParseGear(data io.Reader) (Gear, error) {
 	var gear Gear
 
-	d := json.NewDecoder(data)
-	err := d.Decode(&gear)
+	err := decodeJSON(data, &gear)
 
 	if err == nil && gear.Description.Id == "" {
 		return gear, fmt.Errorf("missing Id")
@@ -170,8 +167,7 @@ func ParseGear(data io.Reader) (Gear, error) {
 func ParseJumpJet(data io.Reader) (JumpJet, error) {
 	var jumpjet JumpJet
 
-	d := json.NewDecoder(data)
-	err := d.Decode(&jumpjet)
+	err := decodeJSON(data, &jumpjet)
 
 	if err == nil && jumpjet.Description.Id == "" {
 		return jumpjet, fmt.Errorf("missing Id")
@@ -182,8 +178,7 @@ func ParseJumpJet(data io.Reader) (JumpJet, error) {
 
 func ParseAmmunition(data io.Reader) (Ammunition, error) {
 	var ammo Ammunition
-	d := json.NewDecoder(data)
-	err := d.Decode(&ammo)
+	err := decodeJSON(data, &ammo)
 
 	if err == nil && ammo.Description.Id == "" {
 		return ammo, fmt.Errorf("missing Id")
@@ -194,8 +189,7 @@ func ParseAmmunition(data io.Reader) (Ammunition, error) {
 
 func ParseAmmunitionBox(data io.Reader) (AmmunitionBox, error) {
 	var ammo AmmunitionBox
-	d := json.NewDecoder(data)
-	err := d.Decode(&ammo)
+	err := decodeJSON(data, &ammo)
 
 	if err == nil && ammo.Description.Id == "" {
 		return ammo, fmt.Errorf("missing Id")
@@ -0,0 +1,186 @@
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"unicode/utf8"
+)
+
+// utf8BOM is the byte order mark some editors put at the start of files.
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// JSONError is an error decoding a JSON file, with the position in the file
+// it happened at.
+type JSONError struct {
+	// File is the name of the file, if it is known.
+	File string
+	// Line and Column start at 1. Column counts characters, not bytes.
+	Line   int
+	Column int
+	Err    error
+}
+
+func (e *JSONError) Error() string {
+	if e.File == "" {
+		return fmt.Sprintf("line %d, column %d: %s", e.Line, e.Column, e.Err)
+	}
+	return fmt.Sprintf("%s:%d:%d: %s", e.File, e.Line, e.Column, e.Err)
+}
+
+func (e *JSONError) Unwrap() error {
+	return e.Err
+}
+
+// decodeJSON decodes the JSON in data into v. It accepts the JSON the game
+// itself does, which is not quite the standard: files may start with a byte
+// order mark, and contain // and /* */ comments and trailing commas in
+// objects and arrays. If data is a file, errors name it.
+func decodeJSON(data io.Reader, v interface{}) error {
+	return decodeLenientJSON(data, v, false)
+}
+
+// decodeJSONValue is decodeJSON for generic values. Numbers are kept exactly
+// as they were written, so that they survive merging unchanged.
+func decodeJSONValue(data io.Reader, v interface{}) error {
+	return decodeLenientJSON(data, v, true)
+}
+
+func decodeLenientJSON(data io.Reader, v interface{}, useNumber bool) error {
+	var name string
+	if named, ok := data.(interface{ Name() string }); ok {
+		name = named.Name()
+	}
+
+	raw, err := ioutil.ReadAll(data)
+	if err != nil {
+		return err
+	}
+	raw = bytes.TrimPrefix(raw, utf8BOM)
+	cleaned := cleanJSON(raw)
+
+	d := json.NewDecoder(bytes.NewReader(cleaned))
+	if useNumber {
+		d.UseNumber()
+	}
+	err = d.Decode(v)
+	if err == nil {
+		return nil
+	}
+
+	var offset int64
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		offset = syntaxErr.Offset
+	case errors.As(err, &typeErr):
+		offset = typeErr.Offset
+	case err == io.EOF || err == io.ErrUnexpectedEOF:
+		offset = int64(len(cleaned))
+		err = fmt.Errorf("unexpected end of JSON input")
+	default:
+		return err
+	}
+
+	// the offset is just past the character the error is about.
+	if offset > 0 {
+		offset--
+	}
+	line, column := position(raw, offset)
+	return &JSONError{File: name, Line: line, Column: column, Err: err}
+}
+
+// cleanJSON returns a copy of data with comments and trailing commas replaced
+// by spaces, which leaves every other byte where it was, so that offsets in
+// the copy are offsets in the original. Newlines in block comments are kept,
+// so that lines are too.
+func cleanJSON(data []byte) []byte {
+	out := make([]byte, len(data))
+	copy(out, data)
+
+	// blank out the comments first, so that a trailing comma followed by a
+	// comment is still found below.
+	inString := false
+	for i := 0; i < len(out); i++ {
+		c := out[i]
+		if inString {
+			switch c {
+			case '\\':
+				i++
+			case '"':
+				inString = false
+			}
+			continue
+		}
+
+		switch {
+		case c == '"':
+			inString = true
+		case c == '/' && i+1 < len(out) && out[i+1] == '/':
+			for ; i < len(out) && out[i] != '\n'; i++ {
+				out[i] = ' '
+			}
+		case c == '/' && i+1 < len(out) && out[i+1] == '*':
+			out[i], out[i+1] = ' ', ' '
+			for i += 2; i < len(out); i++ {
+				if out[i] == '*' && i+1 < len(out) && out[i+1] == '/' {
+					out[i], out[i+1] = ' ', ' '
+					i++
+					break
+				}
+				if out[i] != '\n' {
+					out[i] = ' '
+				}
+			}
+		}
+	}
+
+	inString = false
+	for i := 0; i < len(out); i++ {
+		c := out[i]
+		if inString {
+			switch c {
+			case '\\':
+				i++
+			case '"':
+				inString = false
+			}
+			continue
+		}
+
+		switch c {
+		case '"':
+			inString = true
+		case ',':
+			next := i + 1
+			for next < len(out) && isJSONSpace(out[next]) {
+				next++
+			}
+			if next < len(out) && (out[next] == '}' || out[next] == ']') {
+				out[i] = ' '
+			}
+		}
+	}
+
+	return out
+}
+
+func isJSONSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+// position returns the line and column of the byte at offset in data.
+func position(data []byte, offset int64) (line, column int) {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	before := data[:offset]
+	line = bytes.Count(before, []byte{'\n'}) + 1
+	lineStart := bytes.LastIndexByte(before, '\n') + 1
+	column = utf8.RuneCount(before[lineStart:]) + 1
+	return line, column
+}
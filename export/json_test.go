@@ -0,0 +1,94 @@
+package export
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCleanJSON(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"plain", `{"a": [1, 2]}`, `{"a": [1, 2]}`},
+		{"line comment", "{\"a\": 1 // one\n}", "{\"a\": 1       \n}"},
+		{"block comment", "{/* a\nb */\"a\": 1}", "{    \n    \"a\": 1}"},
+		{"unclosed block comment", "{\"a\": 1 /* a", "{\"a\": 1     "},
+		{"comment markers in strings", `{"a": "// not /* a comment */"}`, `{"a": "// not /* a comment */"}`},
+		{"escaped quote", `{"a": "\"// still a string"}`, `{"a": "\"// still a string"}`},
+		{"trailing commas", "{\"a\": [1, 2,\n],\n}", "{\"a\": [1, 2 \n] \n}"},
+		{"trailing comma before a comment", "[1, // last\n]", "[1         \n]"},
+		{"commas in strings", `{"a": ",}"}`, `{"a": ",}"}`},
+	} {
+		got := string(cleanJSON([]byte(tc.in)))
+		if got != tc.want {
+			t.Errorf("%s: got %q, want %q", tc.name, got, tc.want)
+		}
+		if len(got) != len(tc.in) {
+			t.Errorf("%s: cleaning changed the length from %d to %d", tc.name, len(tc.in), len(got))
+		}
+	}
+}
+
+func TestDecodeJSON(t *testing.T) {
+	var v map[string]interface{}
+	in := "\xEF\xBB\xBF{\n  // the game allows comments\n  \"a\": [1, 2,], /* and */\n  \"b\": \"c\",\n}"
+	if err := decodeJSON(strings.NewReader(in), &v); err != nil {
+		t.Fatalf("got error %s", err)
+	}
+	want := map[string]interface{}{"a": []interface{}{1.0, 2.0}, "b": "c"}
+	if !reflect.DeepEqual(v, want) {
+		t.Errorf("got %v, want %v", v, want)
+	}
+}
+
+func TestDecodeJSONErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		in     string
+		line   int
+		column int
+	}{
+		{"missing comma", "{\n  \"a\": 1\n  \"b\": 2\n}", 3, 3},
+		{"after a comment", "{\n  /* a\n  comment */ \"a\": x\n}", 3, 19},
+		{"after a byte order mark", "\xEF\xBB\xBF{\"a\": x}", 1, 7},
+		{"characters not bytes", "{\"é\": x}", 1, 7},
+		{"wrong type", "{\n  \"Name\": 5\n}", 2, 11},
+		{"unexpected end", "{\n  \"a\": [1,\n", 2, 11},
+	} {
+		var v struct{ Name string }
+		err := decodeJSON(strings.NewReader(tc.in), &v)
+		var jsonErr *JSONError
+		if !errors.As(err, &jsonErr) {
+			t.Errorf("%s: got error %v, want a JSONError", tc.name, err)
+			continue
+		}
+		if jsonErr.Line != tc.line || jsonErr.Column != tc.column {
+			t.Errorf("%s: got error at %d:%d, want %d:%d (%s)", tc.name, jsonErr.Line, jsonErr.Column, tc.line, tc.column, err)
+		}
+	}
+}
+
+func TestDecodeJSONFileError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mod.json")
+	if err := ioutil.WriteFile(path, []byte("{\n  \"Name\": }"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var v struct{ Name string }
+	err = decodeJSON(f, &v)
+	if err == nil || !strings.HasPrefix(err.Error(), path+":2:11: ") {
+		t.Errorf("got error %v, want one at %s:2:11", err, path)
+	}
+}
@@ -1,7 +1,6 @@
 package export
 
 import (
-	"encoding/json"
 	"fmt"
 	"io"
 	"strings"
@@ -32,8 +31,7 @@ type MechLocation struct {
 
 func ParseMechDef(data io.Reader) (MechDef, error) {
 	var mech MechDef
-	d := json.NewDecoder(data)
-	err := d.Decode(&mech)
+	err := decodeJSON(data, &mech)
 
 	if err == nil && mech.Description.Id == "" {
 		return mech, fmt.Errorf("missing Id")
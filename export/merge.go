@@ -0,0 +1,394 @@
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The actions an AdvancedJSONMerge instruction can take, as ModTek names
+// them.
+const (
+	MergeActionArrayAdd       = "ArrayAdd"
+	MergeActionArrayAddAfter  = "ArrayAddAfter"
+	MergeActionArrayAddBefore = "ArrayAddBefore"
+	MergeActionArrayConcat    = "ArrayConcat"
+	MergeActionObjectMerge    = "ObjectMerge"
+	MergeActionRemove         = "Remove"
+	MergeActionReplace        = "Replace"
+)
+
+// AdvancedMerge is the content of an AdvancedJSONMerge file, which changes
+// parts of other definitions picked out by JSONPath.
+type AdvancedMerge struct {
+	TargetID  string
+	TargetIDs []string
+	// TargetType is the manifest type of the targets. It need only be set
+	// if definitions of different types share an ID.
+	TargetType   string
+	Instructions []MergeInstruction
+}
+
+// MergeInstruction is a single change made by an AdvancedJSONMerge.
+type MergeInstruction struct {
+	JSONPath string
+	Action   string
+	Value    interface{}
+}
+
+// Targets returns the IDs of every definition the merge changes.
+func (m AdvancedMerge) Targets() []string {
+	targets := append([]string(nil), m.TargetIDs...)
+	if m.TargetID != "" {
+		targets = append(targets, m.TargetID)
+	}
+	return targets
+}
+
+// mergeJSON merges patch into base the way ModTek merges JSON: objects are
+// merged key by key, and anything else in patch, arrays included, replaces
+// what was in base. Nulls in patch are ignored. base may be changed.
+func mergeJSON(base, patch interface{}) interface{} {
+	if patch == nil {
+		return base
+	}
+	baseObject, ok := base.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	for key, value := range patchObject {
+		baseObject[key] = mergeJSON(baseObject[key], value)
+	}
+	return baseObject
+}
+
+// copyJSON returns a deep copy of a generic JSON value, so that the same value
+// can be added in several places and changed in one of them.
+func copyJSON(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		c := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			c[key] = copyJSON(value)
+		}
+		return c
+	case []interface{}:
+		c := make([]interface{}, len(v))
+		for i, value := range v {
+			c[i] = copyJSON(value)
+		}
+		return c
+	default:
+		return v
+	}
+}
+
+// jsonLocation is a place in a JSON document: a key in an object or an index
+// in an array. The root of the document has no parent.
+type jsonLocation struct {
+	parent *jsonLocation
+	key    string
+	index  int
+	// inArray is true if the location is an index in an array.
+	inArray bool
+}
+
+// jsonDocument is a generic JSON value that can be changed in place through
+// jsonLocations.
+type jsonDocument struct {
+	root interface{}
+}
+
+func (d *jsonDocument) get(loc *jsonLocation) interface{} {
+	if loc.parent == nil {
+		return d.root
+	}
+	switch parent := d.get(loc.parent).(type) {
+	case map[string]interface{}:
+		return parent[loc.key]
+	case []interface{}:
+		if loc.index < len(parent) {
+			return parent[loc.index]
+		}
+	}
+	return nil
+}
+
+func (d *jsonDocument) set(loc *jsonLocation, v interface{}) {
+	if loc.parent == nil {
+		d.root = v
+		return
+	}
+	switch parent := d.get(loc.parent).(type) {
+	case map[string]interface{}:
+		parent[loc.key] = v
+	case []interface{}:
+		parent[loc.index] = v
+	}
+}
+
+// apply carries out a single AdvancedJSONMerge instruction.
+func (d *jsonDocument) apply(instruction MergeInstruction) error {
+	path, err := parseJSONPath(instruction.JSONPath)
+	if err != nil {
+		return err
+	}
+	matches := d.find(path)
+	if len(matches) == 0 {
+		return fmt.Errorf("JSONPath %s matches nothing", instruction.JSONPath)
+	}
+
+	// go backwards, so that adding or removing array elements does not move
+	// the matches still to come.
+	for i := len(matches) - 1; i >= 0; i-- {
+		loc := matches[i]
+		value := copyJSON(instruction.Value)
+
+		switch instruction.Action {
+		case MergeActionReplace:
+			d.set(loc, value)
+		case MergeActionObjectMerge:
+			if _, ok := d.get(loc).(map[string]interface{}); !ok {
+				return fmt.Errorf("%s of %s, which is not an object", instruction.Action, instruction.JSONPath)
+			}
+			d.set(loc, mergeJSON(d.get(loc), value))
+		case MergeActionArrayAdd, MergeActionArrayConcat:
+			array, ok := d.get(loc).([]interface{})
+			if !ok {
+				return fmt.Errorf("%s to %s, which is not an array", instruction.Action, instruction.JSONPath)
+			}
+			if instruction.Action == MergeActionArrayAdd {
+				array = append(array, value)
+			} else {
+				values, ok := value.([]interface{})
+				if !ok {
+					return fmt.Errorf("%s of a value that is not an array", instruction.Action)
+				}
+				array = append(array, values...)
+			}
+			d.set(loc, array)
+		case MergeActionArrayAddAfter, MergeActionArrayAddBefore, MergeActionRemove:
+			if loc.parent == nil {
+				return fmt.Errorf("%s of the whole document", instruction.Action)
+			}
+			if !loc.inArray {
+				if instruction.Action != MergeActionRemove {
+					return fmt.Errorf("%s %s, which is not in an array", instruction.Action, instruction.JSONPath)
+				}
+				if object, ok := d.get(loc.parent).(map[string]interface{}); ok {
+					delete(object, loc.key)
+				}
+				continue
+			}
+			array, _ := d.get(loc.parent).([]interface{})
+			at := loc.index
+			if instruction.Action == MergeActionArrayAddAfter {
+				at++
+			}
+			changed := make([]interface{}, 0, len(array)+1)
+			changed = append(changed, array[:at]...)
+			if instruction.Action == MergeActionRemove {
+				changed = append(changed, array[at+1:]...)
+			} else {
+				changed = append(changed, value)
+				changed = append(changed, array[at:]...)
+			}
+			d.set(loc.parent, changed)
+		default:
+			return fmt.Errorf("unknown merge action %q", instruction.Action)
+		}
+	}
+	return nil
+}
+
+// jsonPathSegment is one step of a JSONPath.
+type jsonPathSegment struct {
+	// key is the object key to step into, or "*" for every key or element.
+	key string
+	// index is the array index to step into, if isIndex is set.
+	index   int
+	isIndex bool
+	// filter, if set, keeps the array elements it matches.
+	filter *jsonPathFilter
+}
+
+// jsonPathFilter is a filter expression like ?(@.Location == 'Head').
+type jsonPathFilter struct {
+	field []string
+	equal bool
+	value string
+	// quoted is true if value was a string literal, rather than a number or
+	// other literal.
+	quoted bool
+}
+
+// parseJSONPath parses the subset of JSONPath that merges use in practice:
+// keys, quoted keys, array indexes, wildcards, and filters comparing a field
+// with == or != to a literal.
+func parseJSONPath(path string) ([]jsonPathSegment, error) {
+	p := strings.TrimSpace(path)
+	p = strings.TrimPrefix(p, "$")
+	segments := []jsonPathSegment{}
+
+	for len(p) > 0 {
+		switch {
+		case strings.HasPrefix(p, ".."):
+			return nil, fmt.Errorf("unsupported JSONPath %s: recursive descent", path)
+		case p[0] == '.':
+			p = p[1:]
+		case p[0] == '[':
+			end := strings.IndexByte(p, ']')
+			if strings.HasPrefix(p, "[?(") {
+				end = strings.Index(p, ")]") + 1
+			}
+			if end <= 0 {
+				return nil, fmt.Errorf("bad JSONPath %s: unclosed [", path)
+			}
+			inner := strings.TrimSpace(p[1:end])
+			p = p[end+1:]
+
+			switch {
+			case inner == "*":
+				segments = append(segments, jsonPathSegment{key: "*"})
+			case strings.HasPrefix(inner, "?(") && strings.HasSuffix(inner, ")"):
+				filter, err := parseJSONPathFilter(inner[2 : len(inner)-1])
+				if err != nil {
+					return nil, fmt.Errorf("bad JSONPath %s: %s", path, err)
+				}
+				segments = append(segments, jsonPathSegment{filter: filter})
+			case len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0]:
+				segments = append(segments, jsonPathSegment{key: inner[1 : len(inner)-1]})
+			default:
+				index, err := strconv.Atoi(inner)
+				if err != nil {
+					return nil, fmt.Errorf("bad JSONPath %s: bad index %q", path, inner)
+				}
+				segments = append(segments, jsonPathSegment{index: index, isIndex: true})
+			}
+			continue
+		}
+
+		end := strings.IndexAny(p, ".[")
+		if end < 0 {
+			end = len(p)
+		}
+		if end == 0 {
+			continue
+		}
+		segments = append(segments, jsonPathSegment{key: p[:end]})
+		p = p[end:]
+	}
+
+	return segments, nil
+}
+
+// parseJSONPathFilter parses the inside of ?(...), like @.Location == 'Head'.
+func parseJSONPathFilter(expr string) (*jsonPathFilter, error) {
+	filter := &jsonPathFilter{}
+	op := "=="
+	i := strings.Index(expr, op)
+	if j := strings.Index(expr, "!="); j >= 0 && (i < 0 || j < i) {
+		op, i = "!=", j
+	}
+	if i < 0 {
+		return nil, fmt.Errorf("filter %q is not a comparison", expr)
+	}
+	filter.equal = op == "=="
+
+	field := strings.TrimSpace(expr[:i])
+	if !strings.HasPrefix(field, "@") {
+		return nil, fmt.Errorf("filter %q does not start with @", expr)
+	}
+	field = strings.TrimPrefix(strings.TrimPrefix(field, "@"), ".")
+	if field != "" {
+		filter.field = strings.Split(field, ".")
+	}
+
+	value := strings.TrimSpace(expr[i+len(op):])
+	if len(value) >= 2 && (value[0] == '\'' || value[0] == '"') && value[len(value)-1] == value[0] {
+		value = value[1 : len(value)-1]
+		filter.quoted = true
+	}
+	filter.value = value
+	return filter, nil
+}
+
+// matches returns true if the filter keeps the given array element.
+func (f *jsonPathFilter) matches(element interface{}) bool {
+	v := element
+	for _, key := range f.field {
+		object, ok := v.(map[string]interface{})
+		if !ok {
+			return !f.equal
+		}
+		v = object[key]
+	}
+
+	var equal bool
+	switch v := v.(type) {
+	case string:
+		equal = f.quoted && v == f.value
+	case json.Number:
+		a, aerr := v.Float64()
+		b, berr := strconv.ParseFloat(f.value, 64)
+		equal = !f.quoted && aerr == nil && berr == nil && a == b
+	case bool:
+		equal = !f.quoted && strconv.FormatBool(v) == f.value
+	case nil:
+		equal = !f.quoted && f.value == "null"
+	}
+	return equal == f.equal
+}
+
+// find returns the location of every value the path matches, in document
+// order.
+func (d *jsonDocument) find(path []jsonPathSegment) []*jsonLocation {
+	locations := []*jsonLocation{{}}
+	for _, segment := range path {
+		next := []*jsonLocation{}
+		for _, loc := range locations {
+			switch v := d.get(loc).(type) {
+			case map[string]interface{}:
+				if segment.isIndex || segment.filter != nil {
+					continue
+				}
+				if segment.key == "*" {
+					for _, key := range sortedKeys(v) {
+						next = append(next, &jsonLocation{parent: loc, key: key})
+					}
+				} else if _, ok := v[segment.key]; ok {
+					next = append(next, &jsonLocation{parent: loc, key: segment.key})
+				}
+			case []interface{}:
+				for i, element := range v {
+					switch {
+					case segment.isIndex && segment.index != i:
+						continue
+					case segment.filter != nil && !segment.filter.matches(element):
+						continue
+					case !segment.isIndex && segment.filter == nil && segment.key != "*":
+						continue
+					}
+					next = append(next, &jsonLocation{parent: loc, index: i, inArray: true})
+				}
+			}
+		}
+		locations = next
+	}
+	return locations
+}
+
+func sortedKeys(object map[string]interface{}) []string {
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
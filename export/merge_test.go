@@ -0,0 +1,209 @@
+package export
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// decodeTestJSON decodes a generic JSON value the way merges see them.
+func decodeTestJSON(t *testing.T, s string) interface{} {
+	t.Helper()
+	var v interface{}
+	if err := decodeJSONValue(strings.NewReader(s), &v); err != nil {
+		t.Fatalf("bad test JSON %s: %s", s, err)
+	}
+	return v
+}
+
+// encodeTestJSON encodes a generic JSON value with its keys sorted, for
+// comparing.
+func encodeTestJSON(t *testing.T, v interface{}) string {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestMergeJSON(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		base  string
+		patch string
+		want  string
+	}{
+		{"objects merge", `{"a": 1, "b": {"c": 2, "d": 3}}`, `{"b": {"c": 4}, "e": 5}`, `{"a": 1, "b": {"c": 4, "d": 3}, "e": 5}`},
+		{"arrays replace", `{"a": [1, 2, 3]}`, `{"a": [4]}`, `{"a": [4]}`},
+		{"nulls are ignored", `{"a": 1, "b": {"c": 2}}`, `{"a": null, "b": {"c": null}}`, `{"a": 1, "b": {"c": 2}}`},
+		{"scalar replaces object", `{"a": {"b": 1}}`, `{"a": 2}`, `{"a": 2}`},
+		{"object replaces scalar", `{"a": 2}`, `{"a": {"b": 1}}`, `{"a": {"b": 1}}`},
+		{"numbers are kept as written", `{"a": 1.50}`, `{"b": 2.0}`, `{"a": 1.50, "b": 2.0}`},
+	} {
+		got := encodeTestJSON(t, mergeJSON(decodeTestJSON(t, tc.base), decodeTestJSON(t, tc.patch)))
+		if want := encodeTestJSON(t, decodeTestJSON(t, tc.want)); got != want {
+			t.Errorf("%s: got %s, want %s", tc.name, got, want)
+		}
+	}
+}
+
+func TestJSONDocumentApply(t *testing.T) {
+	const weapon = `{
+		"Description": {"Id": "Weapon_Laser", "Cost": 100},
+		"Tags": ["a", "b"],
+		"Locations": [
+			{"Location": "Head", "Armor": 9},
+			{"Location": "CenterTorso", "Armor": 30}
+		]
+	}`
+
+	for _, tc := range []struct {
+		name        string
+		instruction string
+		// want is the changed document, or empty if the instruction fails.
+		want string
+	}{
+		{
+			name:        "replace",
+			instruction: `{"JSONPath": "$.Description.Cost", "Action": "Replace", "Value": 200}`,
+			want:        `{"Description": {"Id": "Weapon_Laser", "Cost": 200}, "Tags": ["a", "b"], "Locations": [{"Location": "Head", "Armor": 9}, {"Location": "CenterTorso", "Armor": 30}]}`,
+		},
+		{
+			name:        "replace with quoted keys",
+			instruction: `{"JSONPath": "$['Description'][\"Id\"]", "Action": "Replace", "Value": "Weapon_Laser2"}`,
+			want:        `{"Description": {"Id": "Weapon_Laser2", "Cost": 100}, "Tags": ["a", "b"], "Locations": [{"Location": "Head", "Armor": 9}, {"Location": "CenterTorso", "Armor": 30}]}`,
+		},
+		{
+			name:        "replace by index",
+			instruction: `{"JSONPath": "$.Locations[1].Armor", "Action": "Replace", "Value": 40}`,
+			want:        `{"Description": {"Id": "Weapon_Laser", "Cost": 100}, "Tags": ["a", "b"], "Locations": [{"Location": "Head", "Armor": 9}, {"Location": "CenterTorso", "Armor": 40}]}`,
+		},
+		{
+			name:        "replace every element",
+			instruction: `{"JSONPath": "$.Locations[*].Armor", "Action": "Replace", "Value": 1}`,
+			want:        `{"Description": {"Id": "Weapon_Laser", "Cost": 100}, "Tags": ["a", "b"], "Locations": [{"Location": "Head", "Armor": 1}, {"Location": "CenterTorso", "Armor": 1}]}`,
+		},
+		{
+			name:        "replace filtered by string",
+			instruction: `{"JSONPath": "$.Locations[?(@.Location == 'Head')].Armor", "Action": "Replace", "Value": 12}`,
+			want:        `{"Description": {"Id": "Weapon_Laser", "Cost": 100}, "Tags": ["a", "b"], "Locations": [{"Location": "Head", "Armor": 12}, {"Location": "CenterTorso", "Armor": 30}]}`,
+		},
+		{
+			name:        "replace filtered by number",
+			instruction: `{"JSONPath": "$.Locations[?(@.Armor == 30.0)].Location", "Action": "Replace", "Value": "CT"}`,
+			want:        `{"Description": {"Id": "Weapon_Laser", "Cost": 100}, "Tags": ["a", "b"], "Locations": [{"Location": "Head", "Armor": 9}, {"Location": "CT", "Armor": 30}]}`,
+		},
+		{
+			name:        "a quoted number does not match a number",
+			instruction: `{"JSONPath": "$.Locations[?(@.Armor == '30')].Location", "Action": "Replace", "Value": "CT"}`,
+		},
+		{
+			name:        "object merge",
+			instruction: `{"JSONPath": "$.Description", "Action": "ObjectMerge", "Value": {"Cost": 150, "Name": "Laser"}}`,
+			want:        `{"Description": {"Id": "Weapon_Laser", "Cost": 150, "Name": "Laser"}, "Tags": ["a", "b"], "Locations": [{"Location": "Head", "Armor": 9}, {"Location": "CenterTorso", "Armor": 30}]}`,
+		},
+		{
+			name:        "object merge into an array",
+			instruction: `{"JSONPath": "$.Tags", "Action": "ObjectMerge", "Value": {"Cost": 150}}`,
+		},
+		{
+			name:        "array add",
+			instruction: `{"JSONPath": "$.Tags", "Action": "ArrayAdd", "Value": "c"}`,
+			want:        `{"Description": {"Id": "Weapon_Laser", "Cost": 100}, "Tags": ["a", "b", "c"], "Locations": [{"Location": "Head", "Armor": 9}, {"Location": "CenterTorso", "Armor": 30}]}`,
+		},
+		{
+			name:        "array add to an object",
+			instruction: `{"JSONPath": "$.Description", "Action": "ArrayAdd", "Value": "c"}`,
+		},
+		{
+			name:        "array concat",
+			instruction: `{"JSONPath": "$.Tags", "Action": "ArrayConcat", "Value": ["c", "d"]}`,
+			want:        `{"Description": {"Id": "Weapon_Laser", "Cost": 100}, "Tags": ["a", "b", "c", "d"], "Locations": [{"Location": "Head", "Armor": 9}, {"Location": "CenterTorso", "Armor": 30}]}`,
+		},
+		{
+			name:        "array add before",
+			instruction: `{"JSONPath": "$.Tags[?(@ == 'b')]", "Action": "ArrayAddBefore", "Value": "z"}`,
+			want:        `{"Description": {"Id": "Weapon_Laser", "Cost": 100}, "Tags": ["a", "z", "b"], "Locations": [{"Location": "Head", "Armor": 9}, {"Location": "CenterTorso", "Armor": 30}]}`,
+		},
+		{
+			name:        "array add after",
+			instruction: `{"JSONPath": "$.Tags[0]", "Action": "ArrayAddAfter", "Value": "z"}`,
+			want:        `{"Description": {"Id": "Weapon_Laser", "Cost": 100}, "Tags": ["a", "z", "b"], "Locations": [{"Location": "Head", "Armor": 9}, {"Location": "CenterTorso", "Armor": 30}]}`,
+		},
+		{
+			name:        "array add before every element",
+			instruction: `{"JSONPath": "$.Tags[*]", "Action": "ArrayAddBefore", "Value": "z"}`,
+			want:        `{"Description": {"Id": "Weapon_Laser", "Cost": 100}, "Tags": ["z", "a", "z", "b"], "Locations": [{"Location": "Head", "Armor": 9}, {"Location": "CenterTorso", "Armor": 30}]}`,
+		},
+		{
+			name:        "array add before a key",
+			instruction: `{"JSONPath": "$.Description.Cost", "Action": "ArrayAddBefore", "Value": "z"}`,
+		},
+		{
+			name:        "remove element",
+			instruction: `{"JSONPath": "$.Locations[?(@.Location != 'Head')]", "Action": "Remove"}`,
+			want:        `{"Description": {"Id": "Weapon_Laser", "Cost": 100}, "Tags": ["a", "b"], "Locations": [{"Location": "Head", "Armor": 9}]}`,
+		},
+		{
+			name:        "remove every element",
+			instruction: `{"JSONPath": "$.Tags[*]", "Action": "Remove"}`,
+			want:        `{"Description": {"Id": "Weapon_Laser", "Cost": 100}, "Tags": [], "Locations": [{"Location": "Head", "Armor": 9}, {"Location": "CenterTorso", "Armor": 30}]}`,
+		},
+		{
+			name:        "remove key",
+			instruction: `{"JSONPath": "$.Description.Cost", "Action": "Remove"}`,
+			want:        `{"Description": {"Id": "Weapon_Laser"}, "Tags": ["a", "b"], "Locations": [{"Location": "Head", "Armor": 9}, {"Location": "CenterTorso", "Armor": 30}]}`,
+		},
+		{
+			name:        "remove the document",
+			instruction: `{"JSONPath": "$", "Action": "Remove"}`,
+		},
+		{
+			name:        "path matches nothing",
+			instruction: `{"JSONPath": "$.Description.Name", "Action": "Replace", "Value": "Laser"}`,
+		},
+		{
+			name:        "recursive descent",
+			instruction: `{"JSONPath": "$..Armor", "Action": "Replace", "Value": 1}`,
+		},
+		{
+			name:        "unknown action",
+			instruction: `{"JSONPath": "$.Tags", "Action": "ArrayShuffle"}`,
+		},
+	} {
+		var instruction MergeInstruction
+		if err := decodeJSONValue(strings.NewReader(tc.instruction), &instruction); err != nil {
+			t.Fatalf("%s: bad instruction: %s", tc.name, err)
+		}
+		doc := &jsonDocument{root: decodeTestJSON(t, weapon)}
+		err := doc.apply(instruction)
+		if tc.want == "" {
+			if err == nil {
+				t.Errorf("%s: got no error, and %s", tc.name, encodeTestJSON(t, doc.root))
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: got error %s", tc.name, err)
+			continue
+		}
+		if got, want := encodeTestJSON(t, doc.root), encodeTestJSON(t, decodeTestJSON(t, tc.want)); got != want {
+			t.Errorf("%s: got\n%s\nwant\n%s", tc.name, got, want)
+		}
+	}
+}
+
+func TestApplyCopiesValues(t *testing.T) {
+	doc := &jsonDocument{root: decodeTestJSON(t, `{"a": [{"b": 1}, {"b": 2}]}`)}
+	value := decodeTestJSON(t, `{"c": 3}`)
+	if err := doc.apply(MergeInstruction{JSONPath: "$.a[*]", Action: MergeActionObjectMerge, Value: value}); err != nil {
+		t.Fatal(err)
+	}
+	// each element got its own copy, so changing one leaves the other alone.
+	doc.root.(map[string]interface{})["a"].([]interface{})[0].(map[string]interface{})["c"] = "changed"
+	want := `{"a":[{"b":1,"c":"changed"},{"b":2,"c":3}]}`
+	if got := encodeTestJSON(t, doc.root); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,217 @@
+package export
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// readModsDirectory reads the mod.json of every mod in the mods directory.
+func readModsDirectory(path string) ([]loadedMod, []error) {
+	// List the directory contents
+	files, err := ioutil.ReadDir(path)
+	if err != nil {
+		logrus.Errorf("error reading mods directory: %s", err)
+		return nil, []error{err}
+	}
+
+	mods := []loadedMod{}
+	errors := []error{}
+	for _, file := range files {
+		// skip any raw files. They don't have anything we care about.
+		if !file.IsDir() {
+			continue
+		}
+
+		// skip the .git directories, if present.
+		if strings.Contains(file.Name(), ".git") {
+			continue
+		}
+
+		mod, err := loadMod(filepath.Join(path, file.Name()))
+		if err != nil {
+			errors = append(errors, err)
+			continue
+		}
+		mods = append(mods, mod)
+	}
+
+	return mods, errors
+}
+
+// loadOrder returns the mods in the order ModTek loads them: every mod after
+// the mods it depends on, and otherwise in name order. Disabled mods are left
+// out unless includeDisabled is set. Mods that cannot be loaded, because a
+// mod they depend on is missing, because they conflict with another mod, or
+// because their dependencies form a cycle, are left out and reported as
+// errors.
+func loadOrder(mods []loadedMod, includeDisabled bool) ([]loadedMod, []error) {
+	errors := []error{}
+
+	byName := map[string]loadedMod{}
+	for _, mod := range mods {
+		if !mod.Def.Enabled && !includeDisabled {
+			logrus.Infof("skipping disabled mod %q", mod.Def.Name)
+			continue
+		}
+		if other, ok := byName[mod.Def.Name]; ok {
+			err := fmt.Errorf("mods in %s and %s are both named %q", other.Path, mod.Path, mod.Def.Name)
+			logrus.Errorf("%s", err)
+			errors = append(errors, err)
+			continue
+		}
+		byName[mod.Def.Name] = mod
+	}
+
+	// neither side of a conflict is loaded, since there is no telling which
+	// one the game would end up with.
+	failed := map[string]bool{}
+	for _, name := range sortedModNames(byName) {
+		for _, conflict := range byName[name].Def.ConflictsWith {
+			if _, ok := byName[conflict]; ok {
+				err := fmt.Errorf("mod %q conflicts with mod %q", name, conflict)
+				logrus.Errorf("%s", err)
+				errors = append(errors, err)
+				failed[name] = true
+				failed[conflict] = true
+			}
+		}
+	}
+
+	// a mod whose required dependency is missing or failed fails too, which
+	// may fail the mods that depend on it in turn.
+	for changed := true; changed; {
+		changed = false
+		for _, name := range sortedModNames(byName) {
+			if failed[name] {
+				continue
+			}
+			for _, dependency := range byName[name].Def.DependsOn {
+				_, ok := byName[dependency]
+				if !ok || failed[dependency] {
+					reason := "is missing"
+					if ok {
+						reason = "cannot be loaded"
+					}
+					err := fmt.Errorf("mod %q depends on mod %q, which %s", name, dependency, reason)
+					logrus.Errorf("%s", err)
+					errors = append(errors, err)
+					failed[name] = true
+					changed = true
+					break
+				}
+			}
+		}
+	}
+	for name := range failed {
+		delete(byName, name)
+	}
+
+	// repeatedly take the first mod, by name, whose dependencies have all
+	// been taken already.
+	ordered := []loadedMod{}
+	placed := map[string]bool{}
+	remaining := sortedModNames(byName)
+	for len(remaining) > 0 {
+		next := -1
+		for i, name := range remaining {
+			if dependenciesPlaced(byName[name].Def, byName, placed) {
+				next = i
+				break
+			}
+		}
+		if next < 0 {
+			err := fmt.Errorf("mod dependencies form a cycle: %s", strings.Join(findCycle(remaining, byName), " -> "))
+			logrus.Errorf("%s", err)
+			errors = append(errors, err)
+			break
+		}
+		name := remaining[next]
+		ordered = append(ordered, byName[name])
+		placed[name] = true
+		remaining = append(remaining[:next], remaining[next+1:]...)
+	}
+
+	return ordered, errors
+}
+
+// dependencies returns the names of the mods that must load before the mod,
+// of those that are being loaded.
+func dependencies(mod ModDef, byName map[string]loadedMod) []string {
+	deps := []string{}
+	for _, name := range append(append([]string(nil), mod.DependsOn...), mod.OptionallyDependsOn...) {
+		if _, ok := byName[name]; ok {
+			deps = append(deps, name)
+		}
+	}
+	return deps
+}
+
+func dependenciesPlaced(mod ModDef, byName map[string]loadedMod, placed map[string]bool) bool {
+	for _, name := range dependencies(mod, byName) {
+		if !placed[name] {
+			return false
+		}
+	}
+	return true
+}
+
+// findCycle returns the names of the mods in a dependency cycle among the
+// given mods, starting and ending with the same mod. Every mod given must be
+// waiting on another one given, so following dependencies from any of them
+// must come back around.
+func findCycle(names []string, byName map[string]loadedMod) []string {
+	waiting := map[string]bool{}
+	for _, name := range names {
+		waiting[name] = true
+	}
+
+	path := []string{}
+	seen := map[string]int{}
+	name := names[0]
+	for {
+		if i, ok := seen[name]; ok {
+			return append(path[i:], name)
+		}
+		seen[name] = len(path)
+		path = append(path, name)
+
+		next := ""
+		for _, dependency := range dependencies(byName[name].Def, byName) {
+			if waiting[dependency] {
+				next = dependency
+				break
+			}
+		}
+		if next == "" {
+			return path
+		}
+		name = next
+	}
+}
+
+func sortedModNames(byName map[string]loadedMod) []string {
+	names := make([]string, 0, len(byName))
+	for name := range byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ModLoadOrder returns the definitions of the mods in the mods directory, in
+// the order they are loaded.
+func ModLoadOrder(path string, includeDisabled bool) ([]ModDef, []error) {
+	mods, errors := readModsDirectory(path)
+	ordered, orderErrors := loadOrder(mods, includeDisabled)
+
+	defs := make([]ModDef, 0, len(ordered))
+	for _, mod := range ordered {
+		defs = append(defs, mod.Def)
+	}
+	return defs, append(errors, orderErrors...)
+}
@@ -0,0 +1,140 @@
+package export
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testMod is an enabled mod with the given name, and the mods it depends
+// on.
+func testMod(name string, dependsOn ...string) loadedMod {
+	return loadedMod{Path: name, Def: ModDef{Name: name, Enabled: true, DependsOn: dependsOn}}
+}
+
+func TestLoadOrder(t *testing.T) {
+	optional := testMod("A")
+	optional.Def.OptionallyDependsOn = []string{"C", "Missing"}
+	conflicting := testMod("A")
+	conflicting.Def.ConflictsWith = []string{"B"}
+	disabled := testMod("A")
+	disabled.Def.Enabled = false
+
+	for _, tc := range []struct {
+		name            string
+		mods            []loadedMod
+		includeDisabled bool
+		want            []string
+		// errors are strings each expected error contains, in order.
+		errors []string
+	}{
+		{
+			name: "name order",
+			mods: []loadedMod{testMod("C"), testMod("A"), testMod("B")},
+			want: []string{"A", "B", "C"},
+		},
+		{
+			name: "dependencies first",
+			mods: []loadedMod{testMod("A", "C"), testMod("B"), testMod("C", "D"), testMod("D")},
+			want: []string{"B", "D", "C", "A"},
+		},
+		{
+			name: "optional dependencies first, if they are there",
+			mods: []loadedMod{optional, testMod("B"), testMod("C")},
+			want: []string{"B", "C", "A"},
+		},
+		{
+			name:   "missing dependency",
+			mods:   []loadedMod{testMod("A", "Missing"), testMod("B", "A"), testMod("C")},
+			want:   []string{"C"},
+			errors: []string{`mod "A" depends on mod "Missing", which is missing`, `mod "B" depends on mod "A", which cannot be loaded`},
+		},
+		{
+			name:   "conflict",
+			mods:   []loadedMod{conflicting, testMod("B"), testMod("C")},
+			want:   []string{"C"},
+			errors: []string{`mod "A" conflicts with mod "B"`},
+		},
+		{
+			name:   "cycle",
+			mods:   []loadedMod{testMod("A", "B"), testMod("B", "C"), testMod("C", "A"), testMod("D")},
+			want:   []string{"D"},
+			errors: []string{"cycle: A -> B -> C -> A"},
+		},
+		{
+			name:   "duplicate names",
+			mods:   []loadedMod{testMod("A"), testMod("A")},
+			want:   []string{"A"},
+			errors: []string{`both named "A"`},
+		},
+		{
+			name: "disabled mods are skipped",
+			mods: []loadedMod{disabled, testMod("B")},
+			want: []string{"B"},
+		},
+		{
+			name:   "disabled dependencies are missing",
+			mods:   []loadedMod{disabled, testMod("B", "A")},
+			want:   []string{},
+			errors: []string{`mod "B" depends on mod "A", which is missing`},
+		},
+		{
+			name:            "disabled mods included",
+			mods:            []loadedMod{disabled, testMod("B", "A")},
+			includeDisabled: true,
+			want:            []string{"A", "B"},
+		},
+	} {
+		ordered, errs := loadOrder(tc.mods, tc.includeDisabled)
+		names := []string{}
+		for _, mod := range ordered {
+			names = append(names, mod.Def.Name)
+		}
+		if !reflect.DeepEqual(names, tc.want) {
+			t.Errorf("%s: got order %v, want %v", tc.name, names, tc.want)
+		}
+		if len(errs) != len(tc.errors) {
+			t.Errorf("%s: got errors %v, want %d", tc.name, errs, len(tc.errors))
+			continue
+		}
+		for i, err := range errs {
+			if !strings.Contains(err.Error(), tc.errors[i]) {
+				t.Errorf("%s: got error %q, want %q", tc.name, err, tc.errors[i])
+			}
+		}
+	}
+}
+
+func TestModLoadOrder(t *testing.T) {
+	dir := writeMods(t, map[string]string{
+		"Core/mod.json":    `{"Name": "Core"}`,
+		"Addon/mod.json":   `{"Name": "Addon", "DependsOn": ["Core"]}`,
+		"Old/mod.json":     `{"Name": "Old", "Enabled": false}`,
+		"Lenient/mod.json": `{"Name": "Lenient",}`,
+		"NoMod/readme.txt": "not a mod",
+		".git/config":      "",
+		"loose.json":       "{}",
+	})
+
+	for _, tc := range []struct {
+		includeDisabled bool
+		want            []string
+	}{
+		{false, []string{"Core", "Addon", "Lenient"}},
+		{true, []string{"Core", "Addon", "Lenient", "Old"}},
+	} {
+		defs, errs := ModLoadOrder(dir, tc.includeDisabled)
+		names := []string{}
+		for _, def := range defs {
+			names = append(names, def.Name)
+		}
+		if !reflect.DeepEqual(names, tc.want) {
+			t.Errorf("includeDisabled %v: got order %v, want %v", tc.includeDisabled, names, tc.want)
+		}
+		// the directory without a mod.json is the only error; trailing
+		// commas are allowed.
+		if len(errs) != 1 {
+			t.Errorf("includeDisabled %v: got errors %v, want 1", tc.includeDisabled, errs)
+		}
+	}
+}
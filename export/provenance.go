@@ -0,0 +1,65 @@
+package export
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// ProvenanceFile is the name of the file, written alongside the exported
+// pages, that records which mod each page came from.
+const ProvenanceFile = "provenance.json"
+
+// PageSource is the mod that defines an exported page.
+type PageSource struct {
+	Mod     string `json:"mod"`
+	Version string `json:"version,omitempty"`
+	// Merged names the other mods that merged changes into the page's
+	// definitions, in load order.
+	Merged []string `json:"merged,omitempty"`
+}
+
+// Provenance records where every exported page came from, keyed by page
+// title.
+type Provenance struct {
+	// Commit is the git commit the mods directory was at, if it is a git
+	// repository.
+	Commit string                `json:"commit,omitempty"`
+	Pages  map[string]PageSource `json:"pages"`
+}
+
+// LoadProvenance reads a provenance file written by an export.
+func LoadProvenance(path string) (Provenance, error) {
+	var p Provenance
+
+	file, err := os.Open(path)
+	if err != nil {
+		return p, err
+	}
+	defer file.Close()
+
+	d := json.NewDecoder(file)
+	err = d.Decode(&p)
+	return p, err
+}
+
+// Write writes the provenance to the given path as JSON.
+func (p Provenance) Write(path string) error {
+	d, err := json.MarshalIndent(p, "", "\t")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(d, '\n'), 0644)
+}
+
+// GitCommit returns the commit the git repository at dir is checked out at,
+// or the empty string if dir is not a git repository or git is unavailable.
+func GitCommit(dir string) string {
+	out, err := exec.Command("git", "-C", dir, "rev-parse", "HEAD").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
@@ -0,0 +1,348 @@
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ManifestTypeAdvancedJSONMerge is the manifest type of files that change
+// parts of other definitions, instead of defining anything themselves.
+const ManifestTypeAdvancedJSONMerge = "AdvancedJSONMerge"
+
+// loadedMod is a mod whose mod.json has been read.
+type loadedMod struct {
+	Path string
+	Def  ModDef
+}
+
+// definition is a single game definition, as it stands once every mod that
+// touches it has been applied.
+type definition struct {
+	Type string
+	// ID is the name of the file that defines it, without the extension,
+	// which is how ModTek tells definitions apart.
+	ID string
+	// Path is the file the definition was last loaded from.
+	Path string
+	// Owner is the index, in load order, of the mod the definition was last
+	// loaded from.
+	Owner int
+	// Mods names the mod the definition was last loaded from, followed by
+	// every mod that merged into it, in load order.
+	Mods []string
+	Data []byte
+}
+
+// merged returns the mods that merged into the definition, other than its
+// owner.
+func (d *definition) merged() []string {
+	return d.Mods[1:]
+}
+
+// reader returns a reader for the definition's JSON that names the file it
+// came from, for error messages.
+func (d *definition) reader() *namedReader {
+	return &namedReader{Reader: bytes.NewReader(d.Data), name: d.Path}
+}
+
+// namedReader is a reader that knows the name of the file it reads, like an
+// os.File.
+type namedReader struct {
+	*bytes.Reader
+	name string
+}
+
+func (r *namedReader) Name() string {
+	return r.name
+}
+
+// pendingMerge is a merge waiting for every definition to be loaded.
+type pendingMerge struct {
+	mod  int
+	path string
+	// key is the definition a plain merge applies to. Advanced merges name
+	// their own targets.
+	key      string
+	data     []byte
+	advanced bool
+}
+
+// definitionKey identifies a definition by manifest type and ID.
+func definitionKey(manifestType, id string) string {
+	return manifestType + "/" + id
+}
+
+// definitionID returns the ID of the definition in the file at path.
+func definitionID(path string) string {
+	name := filepath.Base(path)
+	return strings.TrimSuffix(name, filepath.Ext(name))
+}
+
+// loadMod reads the mod.json of the mod at modpath.
+func loadMod(modpath string) (loadedMod, error) {
+	modfilePath := filepath.Join(modpath, "mod.json")
+	mod := loadedMod{Path: modpath}
+
+	modfile, err := os.Open(modfilePath)
+	if err != nil {
+		logrus.Warnf("directory %s has no mod.json: %s", modpath, err)
+		return mod, err
+	}
+	defer modfile.Close()
+
+	// mods are enabled unless they say otherwise.
+	mod.Def.Enabled = true
+	err = decodeJSON(modfile, &mod.Def)
+	if err != nil {
+		logrus.Errorf("error parsing %s: %s", modfilePath, err)
+		return mod, err
+	}
+	return mod, nil
+}
+
+// manifestExtensions maps each manifest type read here to the extension of
+// its files. Entries of any other type, like sprites and sounds, are skipped.
+var manifestExtensions = map[string]string{
+	ManifestTypeChassisDef:        ".json",
+	ManifestTypeMechDef:           ".json",
+	ManifestTypeHeatsink:          ".json",
+	ManifestTypeUpgrade:           ".json",
+	ManifestTypeJumpJet:           ".json",
+	ManifestTypeWeapon:            ".json",
+	ManifestTypeAmmunition:        ".json",
+	ManifestTypeAmmunitionBox:     ".json",
+	ManifestTypeVehicleChassisDef: ".json",
+	ManifestTypeVehicleDef:        ".json",
+	ManifestTypeAdvancedJSONMerge: ".json",
+}
+
+// manifestFile is a single file named by a manifest entry.
+type manifestFile struct {
+	Path string
+	ID   string
+}
+
+// manifestFiles returns every file a manifest entry names. The entry's path
+// may be a single file, or a directory, whose files of the right extension
+// are all included, however deeply nested.
+func manifestFiles(modpath string, manifest ModManifest) ([]manifestFile, error) {
+	p := filepath.Join(modpath, manifest.Path)
+	info, err := os.Stat(p)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s path %s: %s", manifest.Type, p, err)
+	}
+	if !info.IsDir() {
+		id := manifest.Id
+		if id == "" {
+			id = definitionID(p)
+		}
+		return []manifestFile{{Path: p, ID: id}}, nil
+	}
+
+	if manifest.Id != "" {
+		// ModTek only uses Id for single files. Every file in a directory
+		// keeps its own name as its ID.
+		logrus.Warnf("ignoring Id %s of %s entry %s, which is a directory", manifest.Id, manifest.Type, p)
+	}
+
+	extension := manifestExtensions[manifest.Type]
+	files := []manifestFile{}
+	err = filepath.Walk(p, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		if !strings.EqualFold(filepath.Ext(path), extension) {
+			logrus.Debugf("skipping %s, which is not a %s file", path, extension)
+			return nil
+		}
+		files = append(files, manifestFile{Path: path, ID: definitionID(path)})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s directory %s: %s", manifest.Type, p, err)
+	}
+	return files, nil
+}
+
+// resolveDefinitions applies the mods in load order, the way ModTek does. A
+// manifest entry replaces any definition of the same type and ID from an
+// earlier mod. Once every definition is loaded, the mods' merges are applied
+// to them in load order: files listed under Merges are merged into the
+// definition of the same type and ID, as are the files of manifest entries
+// with ShouldMergeJSON set, and AdvancedJSONMerge files
+// make the changes they list. Definitions are returned in the order they were
+// first loaded.
+func resolveDefinitions(mods []loadedMod) ([]*definition, []error) {
+	var (
+		errors  []error
+		order   []string
+		defs    = map[string]*definition{}
+		byID    = map[string][]*definition{}
+		pending []pendingMerge
+	)
+
+	for i, mod := range mods {
+		// the mod's Merges are merged in just like manifest entries that
+		// ask to be.
+		entries := append([]ModManifest(nil), mod.Def.Manifest...)
+		for _, merge := range mod.Def.Merges {
+			merge.ShouldMergeJSON = true
+			entries = append(entries, merge)
+		}
+
+		for _, manifest := range entries {
+			if _, ok := manifestExtensions[manifest.Type]; !ok {
+				logrus.Debugf("ignoring %s entry %s", manifest.Type, manifest.Path)
+				continue
+			}
+			files, err := manifestFiles(mod.Path, manifest)
+			if err != nil {
+				logrus.Errorf("%s", err)
+				errors = append(errors, err)
+				continue
+			}
+			for _, file := range files {
+				data, err := ioutil.ReadFile(file.Path)
+				if err != nil {
+					logrus.Errorf("error reading %s: %s", file.Path, err)
+					errors = append(errors, err)
+					continue
+				}
+
+				key := definitionKey(manifest.Type, file.ID)
+				switch {
+				case manifest.Type == ManifestTypeAdvancedJSONMerge:
+					pending = append(pending, pendingMerge{mod: i, path: file.Path, data: data, advanced: true})
+					continue
+				case manifest.ShouldMergeJSON:
+					pending = append(pending, pendingMerge{mod: i, path: file.Path, key: key, data: data})
+					continue
+				case manifest.ShouldAppendText:
+					// ModTek only appends to text resources, like CSV
+					// files. Every type read here is JSON.
+					logrus.Warnf("ignoring %s, ShouldAppendText does not apply to %s", file.Path, manifest.Type)
+					continue
+				}
+
+				def, ok := defs[key]
+				if !ok {
+					def = &definition{Type: manifest.Type, ID: file.ID}
+					defs[key] = def
+					order = append(order, key)
+					byID[file.ID] = append(byID[file.ID], def)
+				} else {
+					logrus.Debugf("%s %s from %s overrides %s", manifest.Type, file.ID, mod.Def.Name, def.Mods[0])
+				}
+				def.Path = file.Path
+				def.Owner = i
+				def.Mods = []string{mod.Def.Name}
+				def.Data = data
+			}
+		}
+	}
+
+	for _, merge := range pending {
+		modName := mods[merge.mod].Def.Name
+		var err error
+		if merge.advanced {
+			err = applyAdvancedMerge(merge, modName, byID)
+		} else if def, ok := defs[merge.key]; ok {
+			err = applyMerge(def, merge, modName)
+		} else {
+			// merges into the base game's own definitions are common, and
+			// there is nothing to export for them.
+			logrus.Debugf("skipping merge %s, no mod defines %s", merge.path, merge.key)
+		}
+		if err != nil {
+			err = fmt.Errorf("error merging %s: %s", merge.path, err)
+			logrus.Errorf("%s", err)
+			errors = append(errors, err)
+		}
+	}
+
+	resolved := make([]*definition, 0, len(order))
+	for _, key := range order {
+		resolved = append(resolved, defs[key])
+	}
+	return resolved, errors
+}
+
+// applyMerge merges a file into a definition.
+func applyMerge(def *definition, merge pendingMerge, modName string) error {
+	var base, patch interface{}
+	if err := decodeJSONValue(def.reader(), &base); err != nil {
+		return err
+	}
+	if err := decodeJSONValue(&namedReader{Reader: bytes.NewReader(merge.data), name: merge.path}, &patch); err != nil {
+		return err
+	}
+	return def.update(mergeJSON(base, patch), modName)
+}
+
+// applyAdvancedMerge makes the changes an AdvancedJSONMerge file lists to each
+// of its targets.
+func applyAdvancedMerge(merge pendingMerge, modName string, byID map[string][]*definition) error {
+	var advanced AdvancedMerge
+	if err := decodeJSONValue(&namedReader{Reader: bytes.NewReader(merge.data), name: merge.path}, &advanced); err != nil {
+		return err
+	}
+
+	for _, target := range advanced.Targets() {
+		candidates := []*definition{}
+		for _, def := range byID[target] {
+			if advanced.TargetType == "" || def.Type == advanced.TargetType {
+				candidates = append(candidates, def)
+			}
+		}
+		switch len(candidates) {
+		case 0:
+			logrus.Debugf("skipping merge %s into %s, which no mod defines", merge.path, target)
+			continue
+		case 1:
+		default:
+			return fmt.Errorf("%d definitions have the ID %s, set TargetType to pick one", len(candidates), target)
+		}
+		def := candidates[0]
+
+		doc := &jsonDocument{}
+		if err := decodeJSONValue(def.reader(), &doc.root); err != nil {
+			return err
+		}
+		for _, instruction := range advanced.Instructions {
+			if err := doc.apply(instruction); err != nil {
+				return fmt.Errorf("%s: %s", target, err)
+			}
+		}
+		if err := def.update(doc.root, modName); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// update replaces the definition's JSON with the result of a merge by the
+// named mod.
+func (d *definition) update(v interface{}, modName string) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	d.Data = data
+	for _, mod := range d.Mods {
+		if mod == modName {
+			return nil
+		}
+	}
+	d.Mods = append(d.Mods, modName)
+	return nil
+}
@@ -0,0 +1,312 @@
+package export
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeMods writes a mods directory. files maps paths in the directory,
+// starting with the mod's own directory, to their content.
+func writeMods(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for path, content := range files {
+		path = filepath.Join(dir, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// modJSON is the mod.json of a mod with the given manifest and merges
+// entries, which are JSON objects.
+func modJSON(name string, manifest []string, merges ...string) string {
+	return fmt.Sprintf(`{"Name": %q, "Manifest": [%s], "Merges": [%s]}`,
+		name, strings.Join(manifest, ", "), strings.Join(merges, ", "))
+}
+
+// weaponJSON is a weapondef with the given ID, cost and damage.
+func weaponJSON(id string, cost, damage int) string {
+	return fmt.Sprintf(`{"Description": {"Id": %q, "Cost": %d}, "Damage": %d}`, id, cost, damage)
+}
+
+// modWeapons describes the weapons each mod ends up owning, keyed by mod, and
+// who merged into them.
+func modWeapons(mods []ModData) map[string][]string {
+	weapons := map[string][]string{}
+	for _, mod := range mods {
+		for _, w := range mod.Weapons {
+			weapons[mod.Mod] = append(weapons[mod.Mod], fmt.Sprintf(
+				"%s cost %d damage %d merged %v",
+				w.Description.Id, w.Description.Cost, w.Damage, mod.Merged[w.Description.Id],
+			))
+		}
+	}
+	return weapons
+}
+
+const weaponManifest = `{"Type": "WeaponDef", "Path": "weapon"}`
+
+func TestResolveDefinitions(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		files map[string]string
+		want  map[string][]string
+		// errors is the number of errors expected.
+		errors int
+	}{
+		{
+			name: "later mods override",
+			files: map[string]string{
+				"A/mod.json":                        modJSON("A", []string{weaponManifest}),
+				"A/weapon/Weapon_Laser.json":        weaponJSON("Weapon_Laser", 100, 20),
+				"A/weapon/Weapon_PPC.json":          weaponJSON("Weapon_PPC", 300, 50),
+				"B/mod.json":                        modJSON("B", []string{weaponManifest}),
+				"B/weapon/lasers/Weapon_Laser.json": weaponJSON("Weapon_Laser", 120, 25),
+			},
+			want: map[string][]string{
+				"A": {"Weapon_PPC cost 300 damage 50 merged []"},
+				"B": {"Weapon_Laser cost 120 damage 25 merged []"},
+			},
+		},
+		{
+			name: "dependencies load first",
+			files: map[string]string{
+				"A/mod.json":                 `{"Name": "A", "DependsOn": ["B"], "Manifest": [` + weaponManifest + `]}`,
+				"A/weapon/Weapon_Laser.json": weaponJSON("Weapon_Laser", 100, 20),
+				"B/mod.json":                 modJSON("B", []string{weaponManifest}),
+				"B/weapon/Weapon_Laser.json": weaponJSON("Weapon_Laser", 120, 25),
+			},
+			want: map[string][]string{
+				"A": {"Weapon_Laser cost 100 damage 20 merged []"},
+			},
+		},
+		{
+			name: "single file with an id",
+			files: map[string]string{
+				"A/mod.json":                 modJSON("A", []string{`{"Type": "WeaponDef", "Path": "laser.json", "Id": "Weapon_Laser"}`}),
+				"A/laser.json":               weaponJSON("Weapon_Laser", 100, 20),
+				"B/mod.json":                 modJSON("B", []string{weaponManifest}),
+				"B/weapon/Weapon_Laser.json": weaponJSON("Weapon_Laser", 120, 25),
+				"B/weapon/readme.txt":        "not a definition",
+			},
+			want: map[string][]string{
+				"B": {"Weapon_Laser cost 120 damage 25 merged []"},
+			},
+		},
+		{
+			name: "nested directories",
+			files: map[string]string{
+				"A/mod.json":                               modJSON("A", []string{weaponManifest}),
+				"A/weapon/ballistic/Weapon_AC.json":        weaponJSON("Weapon_AC", 200, 40),
+				"A/weapon/energy/lasers/Weapon_Laser.JSON": weaponJSON("Weapon_Laser", 100, 20),
+				"A/weapon/energy/lasers/Weapon_PPC.json":   weaponJSON("Weapon_PPC", 300, 50),
+				// files of other extensions are skipped, at any depth.
+				"A/weapon/readme.md":                      "not a definition",
+				"A/weapon/energy/lasers/Weapon_PPC.png":   "an icon",
+				"A/weapon/energy/lasers/Weapon_PPC.json~": weaponJSON("Weapon_PPC", 1, 1),
+			},
+			want: map[string][]string{
+				"A": {
+					"Weapon_AC cost 200 damage 40 merged []",
+					"Weapon_Laser cost 100 damage 20 merged []",
+					"Weapon_PPC cost 300 damage 50 merged []",
+				},
+			},
+		},
+		{
+			name: "id on a directory is ignored",
+			files: map[string]string{
+				"A/mod.json":                 modJSON("A", []string{`{"Type": "WeaponDef", "Path": "weapon", "Id": "Weapon_Other"}`}),
+				"A/weapon/Weapon_Laser.json": weaponJSON("Weapon_Laser", 100, 20),
+				"B/mod.json":                 modJSON("B", nil, `{"Type": "WeaponDef", "Path": "Weapon_Laser.json"}`),
+				"B/Weapon_Laser.json":        `{"Damage": 30}`,
+			},
+			want: map[string][]string{
+				"A": {"Weapon_Laser cost 100 damage 30 merged [B]"},
+			},
+		},
+		{
+			name: "merge into an earlier mod",
+			files: map[string]string{
+				"A/mod.json":                       modJSON("A", []string{weaponManifest}),
+				"A/weapon/Weapon_Laser.json":       weaponJSON("Weapon_Laser", 100, 20),
+				"A/weapon/Weapon_PPC.json":         weaponJSON("Weapon_PPC", 300, 50),
+				"B/mod.json":                       modJSON("B", []string{`{"Type": "WeaponDef", "Path": "patch", "ShouldMergeJSON": true}`}),
+				"B/patch/nested/Weapon_Laser.json": `{"Damage": 25}`,
+			},
+			// the merged weapon stays with the mod that defines it.
+			want: map[string][]string{
+				"A": {
+					"Weapon_Laser cost 100 damage 25 merged [B]",
+					"Weapon_PPC cost 300 damage 50 merged []",
+				},
+			},
+		},
+		{
+			name: "append text is skipped",
+			files: map[string]string{
+				"A/mod.json":                 modJSON("A", []string{weaponManifest}),
+				"A/weapon/Weapon_Laser.json": weaponJSON("Weapon_Laser", 100, 20),
+				"B/mod.json":                 modJSON("B", []string{`{"Type": "WeaponDef", "Path": "append", "ShouldAppendText": true}`}),
+				"B/append/Weapon_Laser.json": weaponJSON("Weapon_Laser", 120, 25),
+			},
+			want: map[string][]string{
+				"A": {"Weapon_Laser cost 100 damage 20 merged []"},
+			},
+		},
+		{
+			name: "merges apply after every definition is loaded",
+			files: map[string]string{
+				// A merges into a weapon C defines, which loads after it.
+				"A/mod.json":                 modJSON("A", nil, `{"Type": "WeaponDef", "Path": "merges/Weapon_Laser.json"}`),
+				"A/merges/Weapon_Laser.json": `{"Damage": 30}`,
+				"B/mod.json":                 modJSON("B", []string{`{"Type": "WeaponDef", "Path": "patch", "ShouldMergeJSON": true}`}),
+				"B/patch/Weapon_Laser.json":  `{"Description": {"Cost": 150}}`,
+				"B/patch/Weapon_Gauss.json":  `{"Damage": 100}`,
+				"C/mod.json":                 modJSON("C", []string{weaponManifest}),
+				"C/weapon/Weapon_Laser.json": weaponJSON("Weapon_Laser", 100, 20),
+			},
+			want: map[string][]string{
+				"C": {"Weapon_Laser cost 150 damage 30 merged [A B]"},
+			},
+		},
+		{
+			name: "advanced merge",
+			files: map[string]string{
+				"A/mod.json":                 modJSON("A", []string{weaponManifest}),
+				"A/weapon/Weapon_Laser.json": weaponJSON("Weapon_Laser", 100, 20),
+				"A/weapon/Weapon_PPC.json":   weaponJSON("Weapon_PPC", 300, 50),
+				"B/mod.json":                 modJSON("B", []string{`{"Type": "AdvancedJSONMerge", "Path": "advanced"}`}),
+				"B/advanced/damage.json": `{
+					"TargetIDs": ["Weapon_Laser", "Weapon_PPC", "Weapon_Missing"],
+					"Instructions": [
+						{"JSONPath": "Damage", "Action": "Replace", "Value": 99},
+						{"JSONPath": "Description.Cost", "Action": "Remove"}
+					]
+				}`,
+				// a plain merge by a later mod applies after the advanced one.
+				"C/mod.json":        modJSON("C", nil, `{"Type": "WeaponDef", "Path": "Weapon_PPC.json"}`),
+				"C/Weapon_PPC.json": `{"Damage": 60}`,
+			},
+			want: map[string][]string{
+				"A": {
+					"Weapon_Laser cost 0 damage 99 merged [B]",
+					"Weapon_PPC cost 0 damage 60 merged [B C]",
+				},
+			},
+		},
+		{
+			name: "advanced merge target type",
+			files: map[string]string{
+				"A/mod.json":                modJSON("A", []string{weaponManifest, `{"Type": "HeatSinkDef", "Path": "gear"}`}),
+				"A/weapon/Gear_Shared.json": weaponJSON("Gear_Shared", 100, 20),
+				"A/gear/Gear_Shared.json":   `{"Description": {"Id": "Gear_Shared", "Cost": 10}}`,
+				"B/mod.json":                modJSON("B", []string{`{"Type": "AdvancedJSONMerge", "Path": "advanced.json"}`}),
+				"B/advanced.json": `{
+					"TargetID": "Gear_Shared",
+					"TargetType": "WeaponDef",
+					"Instructions": [{"JSONPath": "Damage", "Action": "Replace", "Value": 99}]
+				}`,
+			},
+			want: map[string][]string{
+				"A": {"Gear_Shared cost 100 damage 99 merged [B]"},
+			},
+		},
+		{
+			name: "advanced merge with an ambiguous target",
+			files: map[string]string{
+				"A/mod.json":                modJSON("A", []string{weaponManifest, `{"Type": "HeatSinkDef", "Path": "gear"}`}),
+				"A/weapon/Gear_Shared.json": weaponJSON("Gear_Shared", 100, 20),
+				"A/gear/Gear_Shared.json":   `{"Description": {"Id": "Gear_Shared", "Cost": 10}}`,
+				"B/mod.json":                modJSON("B", []string{`{"Type": "AdvancedJSONMerge", "Path": "advanced.json"}`}),
+				"B/advanced.json": `{
+					"TargetID": "Gear_Shared",
+					"Instructions": [{"JSONPath": "Damage", "Action": "Replace", "Value": 99}]
+				}`,
+			},
+			want: map[string][]string{
+				"A": {"Gear_Shared cost 100 damage 20 merged []"},
+			},
+			errors: 1,
+		},
+		{
+			name: "advanced merge that matches nothing",
+			files: map[string]string{
+				"A/mod.json":                 modJSON("A", []string{weaponManifest}),
+				"A/weapon/Weapon_Laser.json": weaponJSON("Weapon_Laser", 100, 20),
+				"B/mod.json":                 modJSON("B", []string{`{"Type": "AdvancedJSONMerge", "Path": "advanced.json"}`}),
+				"B/advanced.json": `{
+					"TargetID": "Weapon_Laser",
+					"Instructions": [{"JSONPath": "Heat", "Action": "Replace", "Value": 99}]
+				}`,
+			},
+			want: map[string][]string{
+				"A": {"Weapon_Laser cost 100 damage 20 merged []"},
+			},
+			errors: 1,
+		},
+		{
+			name: "missing manifest path",
+			files: map[string]string{
+				"A/mod.json":                 modJSON("A", []string{weaponManifest, `{"Type": "WeaponDef", "Path": "missing"}`}),
+				"A/weapon/Weapon_Laser.json": weaponJSON("Weapon_Laser", 100, 20),
+			},
+			want: map[string][]string{
+				"A": {"Weapon_Laser cost 100 damage 20 merged []"},
+			},
+			errors: 1,
+		},
+	} {
+		mods, errs := WalkModsDirectory(writeMods(t, tc.files), false)
+		if len(errs) != tc.errors {
+			t.Errorf("%s: got errors %v, want %d", tc.name, errs, tc.errors)
+		}
+		if got := modWeapons(mods); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: got weapons\n%v\nwant\n%v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestResolveMechsAcrossMods(t *testing.T) {
+	dir := writeMods(t, map[string]string{
+		"A/mod.json":                      modJSON("A", []string{`{"Type": "ChassisDef", "Path": "chassis"}`}),
+		"A/chassis/chassisdef_atlas.json": `{"Description": {"Id": "chassisdef_atlas", "Name": "Atlas"}, "VariantName": "AS7-D", "Tonnage": 100}`,
+		"B/mod.json":                      modJSON("B", []string{`{"Type": "MechDef", "Path": "mech"}`}),
+		"B/mech/mechdef_atlas.json":       `{"Description": {"Id": "mechdef_atlas"}, "ChassisID": "chassisdef_atlas"}`,
+		"C/mod.json":                      modJSON("C", nil, `{"Type": "ChassisDef", "Path": "chassisdef_atlas.json"}`),
+		"C/chassisdef_atlas.json":         `{"Tonnage": 95}`,
+	})
+	mods, errs := WalkModsDirectory(dir, false)
+	if len(errs) != 0 {
+		t.Fatalf("got errors %v", errs)
+	}
+	if len(mods) != 3 {
+		t.Fatalf("got %d mods, want 3", len(mods))
+	}
+
+	// the mech belongs to the mod with the mechdef, and has the chassis as
+	// merged by the last mod.
+	mech, ok := mods[1].Mechs["Atlas_AS7-D"]
+	if !ok {
+		t.Fatalf("mod B has mechs %v, want Atlas_AS7-D", mods[1].Mechs)
+	}
+	if mech.Chassis.Tonnage != 95 {
+		t.Errorf("got tonnage %v, want the merged 95", mech.Chassis.Tonnage)
+	}
+	if want := []string{"A", "C"}; !reflect.DeepEqual(mods[1].Merged["mechdef_atlas"], want) {
+		t.Errorf("got merged %v, want %v", mods[1].Merged["mechdef_atlas"], want)
+	}
+	if len(mods[0].Mechs) != 0 {
+		t.Errorf("the mod with only the chassis has mechs %v", mods[0].Mechs)
+	}
+}
@@ -0,0 +1,179 @@
+package export
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+const VehicleDefTemplate = "VehicleDef"
+const VehicleLocationTemplate = "VehicleLocation"
+
+// VehicleChassisDef is the golang construction of a vehiclechassisdef json
+// object. Vehicles have no arms, legs or jump jets, so it is a much smaller
+// version of ChassisDef.
+type VehicleChassisDef struct {
+	Description        Description
+	MovementCapDefID   string
+	PathingCapDefID    string
+	HardpointDataDefID string
+	PrefabIdentifier   string
+	PrefabBase         string
+
+	Tonnage     float64
+	WeightClass string `json:"weightClass"`
+	BattleValue int
+	HasTurret   bool
+
+	SpotterDistanceMultiplier float64
+	VisibilityMultiplier      float64
+	SensorRangeMultiplier     float64
+	Signature                 float64
+	Radius                    int
+	Locations                 []VehicleChassisLocation
+
+	ChassisTags    Tags
+	FixedEquipment []InventoryEquipment
+}
+
+// VehicleChassisLocation is one location of a vehicle chassis: its front,
+// sides, rear or turret.
+type VehicleChassisLocation struct {
+	Location   string
+	Hardpoints []struct {
+		WeaponMount string
+		Omni        bool
+	}
+	Tonnage           float64
+	InventorySlots    int
+	MaxArmor          int
+	InternalStructure int
+}
+
+// VehicleDef is the golang construction of the vehicledef json type, the
+// loadout of a vehicle chassis.
+type VehicleDef struct {
+	VehicleTags Tags
+	ChassisID   string
+	Description Description
+	Locations   []VehicleLocation
+	Inventory   []InventoryEquipment `json:"inventory"`
+}
+
+type VehicleLocation struct {
+	Location                 string
+	CurrentArmor             int
+	CurrentInternalStructure int
+	AssignedArmor            int
+}
+
+// CompleteVehicleDef is a vehicle together with its chassis.
+type CompleteVehicleDef struct {
+	Chassis VehicleChassisDef
+	Vehicle VehicleDef
+}
+
+func ParseVehicleChassisDef(data io.Reader) (VehicleChassisDef, error) {
+	var chassis VehicleChassisDef
+	err := decodeJSON(data, &chassis)
+
+	if err == nil && chassis.Description.Id == "" {
+		return chassis, fmt.Errorf("missing Id")
+	}
+	return chassis, err
+}
+
+func ParseVehicleDef(data io.Reader) (VehicleDef, error) {
+	var vehicle VehicleDef
+	err := decodeJSON(data, &vehicle)
+
+	if err == nil && vehicle.Description.Id == "" {
+		return vehicle, fmt.Errorf("missing Id")
+	}
+	return vehicle, err
+}
+
+// ToWiki returns the location as a VehicleLocation template, with the armor
+// the vehicle carries there and the limits its chassis sets.
+func (l VehicleLocation) ToWiki(vehicleID string, chassis VehicleChassisLocation) string {
+	wt := NewWikiTemplate(VehicleLocationTemplate)
+
+	wt.AddArg("VehicleID", vehicleID)
+	wt.AddArg("Location", l.Location)
+	wt.AddArg("CurrentArmor", fmt.Sprint(l.CurrentArmor))
+	wt.AddArg("CurrentInternalStructure", fmt.Sprint(l.CurrentInternalStructure))
+	wt.AddArg("AssignedArmor", fmt.Sprint(l.AssignedArmor))
+	wt.AddArg("MaxArmor", fmt.Sprint(chassis.MaxArmor))
+	wt.AddArg("InternalStructure", fmt.Sprint(chassis.InternalStructure))
+	wt.AddArg("Tonnage", fmt.Sprint(chassis.Tonnage))
+	wt.AddArg("InventorySlots", fmt.Sprint(chassis.InventorySlots))
+
+	hardpoints := []string{}
+	omniHardpoints := []string{}
+	for _, hardpoint := range chassis.Hardpoints {
+		if !hardpoint.Omni {
+			hardpoints = append(hardpoints, hardpoint.WeaponMount)
+		} else {
+			omniHardpoints = append(omniHardpoints, hardpoint.WeaponMount)
+		}
+	}
+
+	wt.AddArg("Hardpoints", strings.Join(hardpoints, ","))
+	wt.AddArg("OmniHardpoints", strings.Join(omniHardpoints, ","))
+
+	return wt.String()
+}
+
+// ToWiki returns the page for the vehicle: a VehicleDef template describing
+// the vehicle and its chassis, a VehicleLocation template for each location,
+// and a MechInventory template for each piece of equipment, the same as
+// mechs use.
+func (vd CompleteVehicleDef) ToWiki() string {
+	wt := NewWikiTemplate(VehicleDefTemplate)
+
+	vd.Vehicle.Description.WikiArgs(wt)
+
+	cd := vd.Chassis
+	wt.AddArg("ChassisID", vd.Vehicle.ChassisID)
+	wt.AddArg("ChassisName", cd.Description.Name)
+	wt.AddArg("Tonnage", fmt.Sprint(cd.Tonnage))
+	wt.AddArg("weightClass", cd.WeightClass)
+	wt.AddArg("HasTurret", cd.HasTurret)
+	wt.AddArg("BattleValue", cd.BattleValue)
+
+	if len(cd.ChassisTags.Items) > 0 {
+		wt.AddArg("ChassisTags", strings.Join(cd.ChassisTags.Items, ","))
+	}
+	if len(vd.Vehicle.VehicleTags.Items) > 0 {
+		wt.AddArg("VehicleTags", strings.Join(vd.Vehicle.VehicleTags.Items, ","))
+	}
+
+	id := vd.Vehicle.Description.Id
+
+	chassisLocations := map[string]VehicleChassisLocation{}
+	for _, location := range cd.Locations {
+		chassisLocations[location.Location] = location
+	}
+	locations := make([]string, len(vd.Vehicle.Locations))
+	for i, location := range vd.Vehicle.Locations {
+		locations[i] = location.ToWiki(id, chassisLocations[location.Location])
+	}
+
+	// fixed equipment and the vehicle's own inventory are counted apart,
+	// the same as for mechs.
+	inventory := []string{}
+	fixedDupes := map[InventoryEquipment]int{}
+	for _, equipment := range cd.FixedEquipment {
+		count := fixedDupes[equipment]
+		inventory = append(inventory, equipment.ToWiki(id, true, count))
+		fixedDupes[equipment] = count + 1
+	}
+	equipmentDupes := map[InventoryEquipment]int{}
+	for _, equipment := range vd.Vehicle.Inventory {
+		count := equipmentDupes[equipment]
+		inventory = append(inventory, equipment.ToWiki(id, false, count))
+		equipmentDupes[equipment] = count + 1
+	}
+
+	return wt.String() + strings.Join(locations, "") + strings.Join(inventory, "")
+}
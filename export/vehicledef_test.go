@@ -0,0 +1,239 @@
+package export
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const vehicleChassisJSON = `{
+	"Description": {"Id": "vehiclechassisdef_SCHREK", "Name": "Schrek"},
+	"Tonnage": 80,
+	"weightClass": "HEAVY",
+	"HasTurret": true,
+	"BattleValue": 1200,
+	"Locations": [
+		{"Location": "Front", "Hardpoints": [{"WeaponMount": "Energy"}], "MaxArmor": 40, "InternalStructure": 20, "InventorySlots": 10},
+		{"Location": "Turret", "Hardpoints": [{"WeaponMount": "Energy"}, {"WeaponMount": "Ballistic", "Omni": true}], "MaxArmor": 30, "InternalStructure": 15, "Tonnage": 2, "InventorySlots": 8}
+	],
+	"ChassisTags": {"items": ["unit_vehicle", "unit_tracked"]},
+	"FixedEquipment": [{"MountedLocation": "Front", "ComponentDefID": "Gear_Armor", "ComponentDefType": "Upgrade"}]
+}`
+
+const vehicleJSON = `{
+	"Description": {"Id": "vehicledef_SCHREK", "Name": "Schrek PPC Carrier", "Cost": 1000},
+	"ChassisID": "vehiclechassisdef_SCHREK",
+	"VehicleTags": {"items": ["unit_release"]},
+	"Locations": [
+		{"Location": "Front", "CurrentArmor": 40, "CurrentInternalStructure": 20, "AssignedArmor": 40},
+		{"Location": "Turret", "CurrentArmor": 25, "CurrentInternalStructure": 15, "AssignedArmor": 25}
+	],
+	"inventory": [
+		{"MountedLocation": "Turret", "ComponentDefID": "Weapon_PPC", "ComponentDefType": "Weapon"},
+		{"MountedLocation": "Turret", "ComponentDefID": "Weapon_PPC", "ComponentDefType": "Weapon"},
+		{"MountedLocation": "Front", "ComponentDefID": "Gear_Armor", "ComponentDefType": "Upgrade"}
+	]
+}`
+
+// testVehicle returns the vehicle in the fixtures, paired with its chassis.
+func testVehicle(t *testing.T) CompleteVehicleDef {
+	t.Helper()
+	chassis, err := ParseVehicleChassisDef(strings.NewReader(vehicleChassisJSON))
+	if err != nil {
+		t.Fatalf("error parsing vehicle chassis: %s", err)
+	}
+	vehicle, err := ParseVehicleDef(strings.NewReader(vehicleJSON))
+	if err != nil {
+		t.Fatalf("error parsing vehicle: %s", err)
+	}
+	return CompleteVehicleDef{Chassis: chassis, Vehicle: vehicle}
+}
+
+func TestParseVehicleDefs(t *testing.T) {
+	vd := testVehicle(t)
+	if vd.Chassis.Tonnage != 80 || vd.Chassis.WeightClass != "HEAVY" || !vd.Chassis.HasTurret || len(vd.Chassis.Locations) != 2 {
+		t.Errorf("got chassis %+v", vd.Chassis)
+	}
+	if hardpoints := vd.Chassis.Locations[1].Hardpoints; len(hardpoints) != 2 || !hardpoints[1].Omni {
+		t.Errorf("got turret hardpoints %+v, want an energy and an omni ballistic", hardpoints)
+	}
+	if vd.Vehicle.ChassisID != "vehiclechassisdef_SCHREK" || len(vd.Vehicle.Locations) != 2 || len(vd.Vehicle.Inventory) != 3 {
+		t.Errorf("got vehicle %+v", vd.Vehicle)
+	}
+	if want := []string{"unit_release"}; !reflect.DeepEqual(vd.Vehicle.VehicleTags.Items, want) {
+		t.Errorf("got vehicle tags %v, want %v", vd.Vehicle.VehicleTags.Items, want)
+	}
+
+	for _, tc := range []struct {
+		name  string
+		parse func(string) error
+		data  string
+	}{
+		{
+			name:  "chassis without an id",
+			parse: func(data string) error { _, err := ParseVehicleChassisDef(strings.NewReader(data)); return err },
+			data:  `{"Description": {"Name": "Schrek"}}`,
+		},
+		{
+			name:  "vehicle without an id",
+			parse: func(data string) error { _, err := ParseVehicleDef(strings.NewReader(data)); return err },
+			data:  `{"ChassisID": "vehiclechassisdef_SCHREK"}`,
+		},
+		{
+			name:  "broken vehicle",
+			parse: func(data string) error { _, err := ParseVehicleDef(strings.NewReader(data)); return err },
+			data:  `{"Description": `,
+		},
+	} {
+		if err := tc.parse(tc.data); err == nil {
+			t.Errorf("%s: parsed without an error", tc.name)
+		}
+	}
+}
+
+func TestResolveVehicles(t *testing.T) {
+	chassisManifest := `{"Type": "VehicleChassisDef", "Path": "chassis"}`
+	vehicleManifest := `{"Type": "VehicleDef", "Path": "vehicle"}`
+
+	for _, tc := range []struct {
+		name  string
+		files map[string]string
+		// want describes the vehicles each mod ends up owning, keyed by
+		// mod.
+		want map[string][]string
+	}{
+		{
+			name: "same mod",
+			files: map[string]string{
+				"A/mod.json": modJSON("A", []string{chassisManifest, vehicleManifest}),
+				"A/chassis/vehiclechassisdef_SCHREK.json": vehicleChassisJSON,
+				"A/vehicle/vehicledef_SCHREK.json":        vehicleJSON,
+			},
+			want: map[string][]string{
+				"A": {"vehicledef_SCHREK on Schrek 80 tons merged []"},
+			},
+		},
+		{
+			name: "chassis from another mod",
+			files: map[string]string{
+				"A/mod.json": modJSON("A", []string{chassisManifest}),
+				"A/chassis/vehiclechassisdef_SCHREK.json": vehicleChassisJSON,
+				"B/mod.json":                       modJSON("B", []string{vehicleManifest}),
+				"B/vehicle/vehicledef_SCHREK.json": vehicleJSON,
+				"C/mod.json":                       modJSON("C", nil, `{"Type": "VehicleChassisDef", "Path": "vehiclechassisdef_SCHREK.json"}`),
+				"C/vehiclechassisdef_SCHREK.json":  `{"Tonnage": 75}`,
+			},
+			// the vehicle belongs to the mod with the vehicledef, and has
+			// the chassis as merged by the last mod.
+			want: map[string][]string{
+				"B": {"vehicledef_SCHREK on Schrek 75 tons merged [A C]"},
+			},
+		},
+		{
+			name: "missing chassis",
+			files: map[string]string{
+				"A/mod.json":                       modJSON("A", []string{vehicleManifest}),
+				"A/vehicle/vehicledef_SCHREK.json": vehicleJSON,
+			},
+			want: map[string][]string{},
+		},
+	} {
+		mods, errs := WalkModsDirectory(writeMods(t, tc.files), false)
+		if len(errs) != 0 {
+			t.Errorf("%s: got errors %v", tc.name, errs)
+		}
+		got := map[string][]string{}
+		for _, mod := range mods {
+			for id, vehicle := range mod.Vehicles {
+				got[mod.Mod] = append(got[mod.Mod], fmt.Sprintf(
+					"%s on %s %v tons merged %v",
+					id, vehicle.Chassis.Description.Name, vehicle.Chassis.Tonnage, mod.Merged[id],
+				))
+			}
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: got vehicles\n%v\nwant\n%v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestVehicleLocationToWiki(t *testing.T) {
+	vd := testVehicle(t)
+	got := vd.Vehicle.Locations[1].ToWiki("vehicledef_SCHREK", vd.Chassis.Locations[1])
+	want := `{{VehicleLocation
+|VehicleID=vehicledef_SCHREK
+|Location=Turret
+|CurrentArmor=25
+|CurrentInternalStructure=15
+|AssignedArmor=25
+|MaxArmor=30
+|InternalStructure=15
+|Tonnage=2
+|InventorySlots=8
+|Hardpoints=Energy
+|OmniHardpoints=Ballistic
+}}
+`
+	if got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestVehicleToWiki(t *testing.T) {
+	got := testVehicle(t).ToWiki()
+
+	for _, tc := range []struct {
+		name string
+		want string
+	}{
+		{
+			name: "vehicle",
+			want: `{{VehicleDef
+|Cost=1000
+|Rarity=0
+|Purchasable=false
+|Id=vehicledef_SCHREK
+|Name=Schrek PPC Carrier
+|ChassisID=vehiclechassisdef_SCHREK
+|ChassisName=Schrek
+|Tonnage=80
+|weightClass=HEAVY
+|HasTurret=true
+|BattleValue=1200
+|ChassisTags=unit_vehicle,unit_tracked
+|VehicleTags=unit_release
+}}
+`,
+		},
+		{
+			name: "front",
+			want: "{{VehicleLocation\n|VehicleID=vehicledef_SCHREK\n|Location=Front\n",
+		},
+		{
+			name: "turret",
+			want: "{{VehicleLocation\n|VehicleID=vehicledef_SCHREK\n|Location=Turret\n",
+		},
+		{
+			name: "fixed equipment",
+			want: "|ComponentDefID=Gear_Armor\n|ComponentDefType=Upgrade\n|HardpointSlot=0\n|FixedEquipment=true\n|Count=0\n",
+		},
+		{
+			name: "second of the same weapon",
+			want: "|ComponentDefID=Weapon_PPC\n|ComponentDefType=Weapon\n|HardpointSlot=0\n|FixedEquipment=false\n|Count=1\n",
+		},
+		{
+			// the vehicle's own copy of fixed equipment is counted apart
+			// from the chassis's.
+			name: "inventory matching fixed equipment",
+			want: "|ComponentDefID=Gear_Armor\n|ComponentDefType=Upgrade\n|HardpointSlot=0\n|FixedEquipment=false\n|Count=0\n",
+		},
+	} {
+		if !strings.Contains(got, tc.want) {
+			t.Errorf("%s: got\n%s\nwant it to contain\n%s", tc.name, got, tc.want)
+		}
+	}
+	if n := strings.Count(got, "{{MechInventory\n"); n != 4 {
+		t.Errorf("got %d inventory templates, want 4", n)
+	}
+}
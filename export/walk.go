@@ -1,39 +1,58 @@
 package export
 
 import (
-	"encoding/json"
 	"fmt"
-	"io/ioutil"
-	"os"
 	"path/filepath"
-	"strings"
 
 	"github.com/sirupsen/logrus"
 )
 
 const (
-	ManifestTypeChassisDef    = "ChassisDef"
-	ManifestTypeMechDef       = "MechDef"
-	ManifestTypeHeatsink      = "HeatSinkDef"
-	ManifestTypeUpgrade       = "UpgradeDef"
-	ManifestTypeJumpJet       = "JumpJetDef"
-	ManifestTypeWeapon        = "WeaponDef"
-	ManifestTypeAmmunition    = "AmmunitionDef"
-	ManifestTypeAmmunitionBox = "AmmunitionBoxDef"
+	ManifestTypeChassisDef        = "ChassisDef"
+	ManifestTypeMechDef           = "MechDef"
+	ManifestTypeHeatsink          = "HeatSinkDef"
+	ManifestTypeUpgrade           = "UpgradeDef"
+	ManifestTypeJumpJet           = "JumpJetDef"
+	ManifestTypeWeapon            = "WeaponDef"
+	ManifestTypeAmmunition        = "AmmunitionDef"
+	ManifestTypeAmmunitionBox     = "AmmunitionBoxDef"
+	ManifestTypeVehicleChassisDef = "VehicleChassisDef"
+	ManifestTypeVehicleDef        = "VehicleDef"
 )
 
 type ModDef struct {
-	Name        string
+	Name string
+	// Enabled is true unless the mod.json turns the mod off.
 	Enabled     bool
 	Hidden      bool
 	Version     string
 	Description string
-	Manifest    []ModManifest
+	// DependsOn and OptionallyDependsOn name the mods that must be loaded
+	// before this one. A mod whose DependsOn are not all there is not
+	// loaded. ConflictsWith names mods that cannot be loaded alongside it.
+	DependsOn           []string
+	OptionallyDependsOn []string
+	ConflictsWith       []string
+	Manifest            []ModManifest
+	// Merges lists files that are merged into the definitions of the same
+	// type and ID, instead of replacing them.
+	Merges []ModManifest
 }
 
 type ModManifest struct {
 	Type string
+	// Path is a file, or a directory whose files are all included, however
+	// deeply nested.
 	Path string
+	// Id replaces the ID of a single file entry, which is otherwise the name
+	// of the file.
+	Id string
+	// ShouldMergeJSON merges the entry's files into the existing definitions
+	// of the same type and ID, instead of replacing them.
+	ShouldMergeJSON bool
+	// ShouldAppendText appends the entry's files to existing text resources.
+	// None of the types read here are text, so such entries are skipped.
+	ShouldAppendText bool
 }
 
 type CompleteMechDef struct {
@@ -43,402 +62,313 @@ type CompleteMechDef struct {
 
 type ModData struct {
 	Mod      string
+	Version  string
 	Mechs    map[string]CompleteMechDef
 	Gear     []Gear
 	Weapons  []Weapon
 	JumpJets []JumpJet
 	Ammo     []CompleteAmmunition
+	// Vehicles is keyed by the vehicle's ID.
+	Vehicles map[string]CompleteVehicleDef
+	// Merged names the other mods that merged into each of the mod's
+	// definitions, in load order, keyed by definition ID. Definitions no
+	// other mod changed are absent. A mech's entry covers both its chassis
+	// and its mechdef.
+	Merged map[string][]string
 }
 
 func combinedNameVariant(chassis ChassisDef) string {
 	return fmt.Sprintf("%s_%s", chassis.Description.Name, chassis.VariantName)
 }
 
-func WalkMechs(modpath string, chassisdefPaths, mechdefPaths []string) (map[string]CompleteMechDef, []error) {
-	mechs := map[string]CompleteMechDef{}
-
-	chassisDefs := map[string]ChassisDef{}
-	errors := []error{}
-
-	for _, chassisdefPath := range chassisdefPaths {
-		p := filepath.Join(modpath, chassisdefPath)
-		chassisFiles, err := ioutil.ReadDir(p)
-		if err != nil {
-			logrus.Errorf("error reading chassis directory: %s", err)
-			errors = append(errors, err)
-		} else {
-			for _, fileinfo := range chassisFiles {
-				chassisPath := filepath.Join(p, fileinfo.Name())
-				file, err := os.Open(chassisPath)
-				if err != nil {
-					logrus.Errorf("error opening %s: %s", fileinfo.Name(), err)
-					errors = append(errors, err)
-					continue
-				}
-
-				cd, err := ParseChassisDef(file)
-				if err != nil {
-					logrus.Errorf("error parsing %s: %s", fileinfo.Name(), err)
-					errors = append(errors, err)
-					continue
-				}
-
-				chassisDefs[cd.Description.Id] = cd
-			}
+// addMerged records that the given mods merged into the definition with the
+// given ID.
+func (m *ModData) addMerged(id string, mods []string) {
+	for _, mod := range mods {
+		found := false
+		for _, merged := range m.Merged[id] {
+			found = found || merged == mod
 		}
-	}
-	logrus.Debugf("parsed %d chassisdefs", len(chassisDefs))
-
-	for _, mechdefPath := range mechdefPaths {
-		p := filepath.Join(modpath, mechdefPath)
-		mechFiles, err := ioutil.ReadDir(p)
-		if err != nil {
-			logrus.Errorf("error reading mechdef directory")
-		} else {
-			for _, fileinfo := range mechFiles {
-				mechPath := filepath.Join(p, fileinfo.Name())
-				file, err := os.Open(mechPath)
-				if err != nil {
-					logrus.Errorf("error opening %s: %s", fileinfo.Name(), err)
-					errors = append(errors, err)
-					continue
-				}
-
-				md, err := ParseMechDef(file)
-				if err != nil {
-					logrus.Errorf("error parsing %s: %s", fileinfo.Name(), err)
-					errors = append(errors, err)
-					continue
-				}
-
-				// if the chassis did not parse correct or is not present,
-				// storing the mechdef
-				chassis, ok := chassisDefs[md.ChassisID]
-				if ok {
-					mechs[combinedNameVariant(chassis)] = CompleteMechDef{
-						Chassis: chassis,
-						Mech:    md,
-					}
-				}
-			}
+		if !found && mod != m.Mod {
+			m.Merged[id] = append(m.Merged[id], mod)
 		}
 	}
-
-	logrus.Debugf("parsed %d mechdefs", len(mechs))
-
-	return mechs, errors
 }
 
-func WalkGear(modpath string, gearPaths []string) ([]Gear, []error) {
+// buildModData parses the resolved definitions into the data of the mods that
+// own them. Mechs may use chassis, and ammunition boxes ammunition, from any
+// mod.
+func buildModData(mods []loadedMod, defs []*definition) ([]ModData, []error) {
 	errors := []error{}
-	var allGear []Gear
-	for _, gearPath := range gearPaths {
-		p := filepath.Join(modpath, gearPath)
-		gearFiles, err := ioutil.ReadDir(p)
-		if err != nil {
-			logrus.Errorf("error reading gear directory %s", p)
-			errors = append(errors, err)
-			continue
+	modData := make([]ModData, len(mods))
+	for i, mod := range mods {
+		modData[i] = ModData{
+			Mod:      mod.Def.Name,
+			Version:  mod.Def.Version,
+			Mechs:    map[string]CompleteMechDef{},
+			Vehicles: map[string]CompleteVehicleDef{},
+			Merged:   map[string][]string{},
 		}
+	}
 
-		for _, fileinfo := range gearFiles {
-			f := filepath.Join(p, fileinfo.Name())
-			file, err := os.Open(f)
+	// chassis and ammunition categories are needed before the definitions
+	// that refer to them.
+	type ownedChassis struct {
+		def     *definition
+		chassis ChassisDef
+	}
+	type ownedVehicleChassis struct {
+		def     *definition
+		chassis VehicleChassisDef
+	}
+	chassisDefs := map[string]ownedChassis{}
+	vehicleChassisDefs := map[string]ownedVehicleChassis{}
+	ammunitionCategories := map[string]string{}
+	for _, def := range defs {
+		switch def.Type {
+		case ManifestTypeChassisDef:
+			cd, err := ParseChassisDef(def.reader())
 			if err != nil {
-				logrus.Errorf("error opening %s: %s", fileinfo.Name(), err)
+				err = fmt.Errorf("error parsing %s: %s", def.Path, err)
+				logrus.Errorf("%s", err)
 				errors = append(errors, err)
 				continue
 			}
-
-			gd, err := ParseGear(file)
+			chassisDefs[cd.Description.Id] = ownedChassis{def: def, chassis: cd}
+		case ManifestTypeVehicleChassisDef:
+			cd, err := ParseVehicleChassisDef(def.reader())
 			if err != nil {
-				logrus.Errorf("error parsing %s: %s", fileinfo.Name(), err)
+				err = fmt.Errorf("error parsing %s: %s", def.Path, err)
+				logrus.Errorf("%s", err)
 				errors = append(errors, err)
 				continue
 			}
-			allGear = append(allGear, gd)
-		}
-	}
-
-	logrus.Debugf("parsed %d gear", len(allGear))
-	return allGear, errors
-}
-
-func WalkJumpJets(modpath string, jumpjetPaths []string) ([]JumpJet, []error) {
-	var (
-		jumpjets []JumpJet
-		errors   []error
-	)
-
-	for _, path := range jumpjetPaths {
-		p := filepath.Join(modpath, path)
-		jumpjetFiles, err := ioutil.ReadDir(p)
-		if err != nil {
-			logrus.Errorf("error reading jumpjet  directory %s", p)
-			errors = append(errors, err)
-			continue
-		}
-
-		for _, fileinfo := range jumpjetFiles {
-			f := filepath.Join(p, fileinfo.Name())
-			file, err := os.Open(f)
+			vehicleChassisDefs[cd.Description.Id] = ownedVehicleChassis{def: def, chassis: cd}
+		case ManifestTypeAmmunition:
+			ammo, err := ParseAmmunition(def.reader())
 			if err != nil {
-				logrus.Errorf("error opening %s: %s", fileinfo.Name(), err)
+				err = fmt.Errorf("error parsing %s: %s", def.Path, err)
+				logrus.Errorf("%s", err)
 				errors = append(errors, err)
 				continue
 			}
-
-			jd, err := ParseJumpJet(file)
-			if err != nil {
-				logrus.Errorf("error parsing %s: %s", fileinfo.Name(), err)
-				errors = append(errors, err)
-				continue
+			if ammo.Category == "" {
+				if ammo.AmmoCategoryID != "" {
+					ammo.Category = ammo.AmmoCategoryID
+				} else {
+					catErr := fmt.Errorf("ammo %s in %s missing category", ammo.Description.Id, def.Path)
+					logrus.Errorf("%s", catErr)
+					errors = append(errors, catErr)
+				}
 			}
-			jumpjets = append(jumpjets, jd)
+			ammunitionCategories[ammo.Description.Id] = ammo.Category
 		}
 	}
+	logrus.Debugf("parsed %d chassisdefs and %d vehicle chassisdefs", len(chassisDefs), len(vehicleChassisDefs))
 
-	logrus.Debugf("parsed %d jumpjets", len(jumpjets))
-	return jumpjets, errors
-}
-
-func WalkWeapons(modpath string, weaponPaths []string) ([]Weapon, []error) {
-	var (
-		errors  []error
-		weapons []Weapon
-	)
-
-	for _, weaponPath := range weaponPaths {
-		p := filepath.Join(modpath, weaponPath)
-		weaponFiles, err := ioutil.ReadDir(p)
-		if err != nil {
-			logrus.Errorf("error reading weapon directory %s", p)
-			errors = append(errors, err)
-			continue
-		}
-
-		for _, fileinfo := range weaponFiles {
-			f := filepath.Join(p, fileinfo.Name())
-			file, err := os.Open(f)
+	for _, def := range defs {
+		data := &modData[def.Owner]
+		switch def.Type {
+		case ManifestTypeMechDef:
+			md, err := ParseMechDef(def.reader())
 			if err != nil {
-				logrus.Errorf("error opening %s: %s", fileinfo.Name(), err)
+				err = fmt.Errorf("error parsing %s: %s", def.Path, err)
+				logrus.Errorf("%s", err)
 				errors = append(errors, err)
 				continue
 			}
 
-			w, err := ParseWeapon(file)
+			// if the chassis did not parse correct or is not present,
+			// skip the mechdef.
+			chassis, ok := chassisDefs[md.ChassisID]
+			if ok {
+				data.Mechs[combinedNameVariant(chassis.chassis)] = CompleteMechDef{
+					Chassis: chassis.chassis,
+					Mech:    md,
+				}
+				data.addMerged(md.Description.Id, def.merged())
+				data.addMerged(md.Description.Id, chassis.def.Mods)
+			}
+		case ManifestTypeVehicleDef:
+			vd, err := ParseVehicleDef(def.reader())
 			if err != nil {
-				logrus.Errorf("error parsing %s: %s", fileinfo.Name(), err)
+				err = fmt.Errorf("error parsing %s: %s", def.Path, err)
+				logrus.Errorf("%s", err)
 				errors = append(errors, err)
 				continue
 			}
-			weapons = append(weapons, w)
-		}
-	}
-
-	logrus.Debugf("parsed %d weapons", len(weapons))
-	return weapons, errors
-}
 
-func WalkAmmunition(modpath string, ammunitionPaths, ammunitionBoxPaths []string) ([]CompleteAmmunition, []error) {
-	var (
-		errors       []error
-		completeAmmo []CompleteAmmunition
-
-		ammunitionCategories = map[string]string{}
-	)
-
-	for _, ammunitionPath := range ammunitionPaths {
-		p := filepath.Join(modpath, ammunitionPath)
-		ammoFiles, err := ioutil.ReadDir(p)
-		if err != nil {
-			logrus.Errorf("error reading Ammunition directory %s", p)
-			errors = append(errors, err)
-			continue
-		}
-
-		for _, fileinfo := range ammoFiles {
-			f := filepath.Join(p, fileinfo.Name())
-
-			file, err := os.Open(f)
+			// as with mechs, a vehicle without its chassis is skipped.
+			chassis, ok := vehicleChassisDefs[vd.ChassisID]
+			if ok {
+				data.Vehicles[vd.Description.Id] = CompleteVehicleDef{
+					Chassis: chassis.chassis,
+					Vehicle: vd,
+				}
+				data.addMerged(vd.Description.Id, def.merged())
+				data.addMerged(vd.Description.Id, chassis.def.Mods)
+			}
+		case ManifestTypeHeatsink, ManifestTypeUpgrade:
+			gd, err := ParseGear(def.reader())
 			if err != nil {
-				logrus.Errorf("error opening %s: %s", fileinfo.Name(), err)
+				err = fmt.Errorf("error parsing %s: %s", def.Path, err)
+				logrus.Errorf("%s", err)
 				errors = append(errors, err)
 				continue
 			}
-
-			ammo, err := ParseAmmunition(file)
+			data.Gear = append(data.Gear, gd)
+			data.addMerged(gd.Description.Id, def.merged())
+		case ManifestTypeJumpJet:
+			jd, err := ParseJumpJet(def.reader())
 			if err != nil {
-				logrus.Errorf("error parsing %s: %s", fileinfo.Name(), err)
+				err = fmt.Errorf("error parsing %s: %s", def.Path, err)
+				logrus.Errorf("%s", err)
 				errors = append(errors, err)
 				continue
 			}
-			if ammo.Category == "" {
-				if ammo.AmmoCategoryID != "" {
-					ammo.Category = ammo.AmmoCategoryID
-				} else {
-					catErr := fmt.Errorf("ammo %s missing category", ammo.Description.Id)
-					logrus.Errorf("%s", catErr)
-					errors = append(errors, catErr)
-				}
-			}
-
-			ammunitionCategories[ammo.Description.Id] = ammo.Category
-		}
-	}
-
-	for _, ammoBoxPath := range ammunitionBoxPaths {
-		p := filepath.Join(modpath, ammoBoxPath)
-		ammoFiles, err := ioutil.ReadDir(p)
-		if err != nil {
-			logrus.Errorf("error reading AmmunitionBox directory %s", p)
-			errors = append(errors, err)
-			continue
-		}
-
-		for _, fileinfo := range ammoFiles {
-			f := filepath.Join(p, fileinfo.Name())
-
-			file, err := os.Open(f)
+			data.JumpJets = append(data.JumpJets, jd)
+			data.addMerged(jd.Description.Id, def.merged())
+		case ManifestTypeWeapon:
+			w, err := ParseWeapon(def.reader())
 			if err != nil {
-				logrus.Errorf("error opening %s: %s", fileinfo.Name(), err)
+				err = fmt.Errorf("error parsing %s: %s", def.Path, err)
+				logrus.Errorf("%s", err)
 				errors = append(errors, err)
 				continue
 			}
-
-			ammo, err := ParseAmmunitionBox(file)
+			data.Weapons = append(data.Weapons, w)
+			data.addMerged(w.Description.Id, def.merged())
+		case ManifestTypeAmmunitionBox:
+			ammo, err := ParseAmmunitionBox(def.reader())
 			if err != nil {
-				logrus.Errorf("error parsing %s: %s", fileinfo.Name(), err)
+				err = fmt.Errorf("error parsing %s: %s", def.Path, err)
+				logrus.Errorf("%s", err)
 				errors = append(errors, err)
 				continue
 			}
 
 			category, ok := ammunitionCategories[ammo.AmmoID]
 			if !ok {
-				catErr := fmt.Errorf("Cannot find category for ammo ID %s", ammo.AmmoID)
+				catErr := fmt.Errorf("Cannot find category for ammo ID %s in %s", ammo.AmmoID, def.Path)
 				logrus.Errorf("%s", catErr)
-				errors = append(errors, err)
+				errors = append(errors, catErr)
 				continue
 			}
 
-			completeAmmo = append(completeAmmo, CompleteAmmunition{
+			data.Ammo = append(data.Ammo, CompleteAmmunition{
 				AmmunitionBox: ammo,
 				Category:      category,
 			})
+			data.addMerged(ammo.Description.Id, def.merged())
+		case ManifestTypeChassisDef, ManifestTypeVehicleChassisDef, ManifestTypeAmmunition:
+			// already parsed above.
+		default:
+			logrus.Debugf("ignoring unknown manifest type %s", def.Type)
 		}
 	}
 
-	return completeAmmo, errors
-}
-
-func WalkMod(modpath string) (ModData, []error) {
-	modfilePath := filepath.Join(modpath, "mod.json")
-
-	modData := ModData{}
-
-	errors := []error{}
-
-	modfile, err := os.Open(modfilePath)
-	if err != nil {
-		logrus.Warnf("directory %s has no mod.json: %s", modpath, err)
-		return modData, []error{err}
+	for _, data := range modData {
+		logrus.Debugf(
+			"mod %q has %d mechs, %d vehicles, %d gear, %d jumpjets, %d weapons and %d ammunition",
+			data.Mod, len(data.Mechs), len(data.Vehicles), len(data.Gear), len(data.JumpJets), len(data.Weapons), len(data.Ammo),
+		)
 	}
-	defer modfile.Close()
-
-	var mod ModDef
-	d := json.NewDecoder(modfile)
-	err = d.Decode(&mod)
-	if err != nil {
-		logrus.Errorf("error parsing %s: %s", modfilePath, err)
-		return modData, []error{err}
-	}
-
-	modData.Mod = mod.Name
 
-	logrus.Infof("checking mod %q", mod.Name)
-
-	var (
-		chassisdefPaths, mechdefPaths                                 []string
-		gearPaths, jumpjetPaths, weaponPaths, ammoPaths, ammoBoxPaths []string
-	)
+	return modData, errors
+}
 
-	for _, manifest := range mod.Manifest {
-		switch manifest.Type {
-		case ManifestTypeChassisDef:
-			chassisdefPaths = append(chassisdefPaths, manifest.Path)
-			logrus.Debugf("mod defines chassisdefs at %s", manifest.Path)
-		case ManifestTypeMechDef:
-			mechdefPaths = append(mechdefPaths, manifest.Path)
-			logrus.Debugf("mod defines mechdefs at %s", manifest.Path)
-		case ManifestTypeHeatsink, ManifestTypeUpgrade:
-			gearPaths = append(gearPaths, manifest.Path)
+// walkMods resolves the definitions of the mods, in the order given, and
+// returns the data of each mod.
+func walkMods(mods []loadedMod) ([]ModData, []error) {
+	for _, mod := range mods {
+		logrus.Infof("checking mod %q", mod.Def.Name)
+		for _, manifest := range mod.Def.Manifest {
 			logrus.Debugf("mod defines %s at %s", manifest.Type, manifest.Path)
-		case ManifestTypeJumpJet:
-			jumpjetPaths = append(jumpjetPaths, manifest.Path)
-			logrus.Debugf("mod define jump jets at %s", manifest.Type, manifest.Path)
-		case ManifestTypeWeapon:
-			weaponPaths = append(weaponPaths, manifest.Path)
-			logrus.Debugf("mod defines weapons at %s", manifest.Path)
-		case ManifestTypeAmmunitionBox:
-			ammoBoxPaths = append(ammoBoxPaths, manifest.Path)
-			logrus.Debugf("mod defines ammo box at %s", manifest.Path)
-		case ManifestTypeAmmunition:
-			ammoPaths = append(ammoPaths, manifest.Path)
-			logrus.Debugf("mod defines ammo at %s", manifest.Path)
-		default:
-			logrus.Debugf("ignoring unknown manifest type %s", manifest.Type)
 		}
 	}
 
-	mechs, mechErrs := WalkMechs(modpath, chassisdefPaths, mechdefPaths)
-	errors = append(errors, mechErrs...)
+	defs, errors := resolveDefinitions(mods)
+	modData, buildErrors := buildModData(mods, defs)
+	return modData, append(errors, buildErrors...)
+}
+
+// pathEntries returns manifest entries of the given type for each path.
+func pathEntries(manifestType string, paths []string) []ModManifest {
+	entries := make([]ModManifest, len(paths))
+	for i, path := range paths {
+		entries[i] = ModManifest{Type: manifestType, Path: path}
+	}
+	return entries
+}
 
-	gear, gearErrs := WalkGear(modpath, gearPaths)
-	errors = append(errors, gearErrs...)
+// walkPaths reads the data of a mod as if its manifest were the one given.
+func walkPaths(modpath string, manifest []ModManifest) (ModData, []error) {
+	mod := loadedMod{
+		Path: modpath,
+		Def:  ModDef{Name: filepath.Base(modpath), Enabled: true, Manifest: manifest},
+	}
+	modData, errors := walkMods([]loadedMod{mod})
+	return modData[0], errors
+}
 
-	jumpjets, jumpjetErrs := WalkJumpJets(modpath, jumpjetPaths)
-	errors = append(errors, jumpjetErrs...)
+// WalkMechs reads the mechs whose chassisdefs and mechdefs are in the given
+// directories of a mod.
+func WalkMechs(modpath string, chassisdefPaths, mechdefPaths []string) (map[string]CompleteMechDef, []error) {
+	data, errors := walkPaths(modpath, append(
+		pathEntries(ManifestTypeChassisDef, chassisdefPaths),
+		pathEntries(ManifestTypeMechDef, mechdefPaths)...,
+	))
+	return data.Mechs, errors
+}
 
-	weapons, weaponErrs := WalkWeapons(modpath, weaponPaths)
-	errors = append(errors, weaponErrs...)
+// WalkGear reads the gear in the given directories of a mod.
+func WalkGear(modpath string, gearPaths []string) ([]Gear, []error) {
+	data, errors := walkPaths(modpath, pathEntries(ManifestTypeHeatsink, gearPaths))
+	return data.Gear, errors
+}
 
-	ammo, ammoErrs := WalkAmmunition(modpath, ammoPaths, ammoBoxPaths)
-	errors = append(errors, ammoErrs...)
+// WalkJumpJets reads the jump jets in the given directories of a mod.
+func WalkJumpJets(modpath string, jumpjetPaths []string) ([]JumpJet, []error) {
+	data, errors := walkPaths(modpath, pathEntries(ManifestTypeJumpJet, jumpjetPaths))
+	return data.JumpJets, errors
+}
 
-	modData.Mechs = mechs
-	modData.Gear = gear
-	modData.JumpJets = jumpjets
-	modData.Weapons = weapons
-	modData.Ammo = ammo
+// WalkWeapons reads the weapons in the given directories of a mod.
+func WalkWeapons(modpath string, weaponPaths []string) ([]Weapon, []error) {
+	data, errors := walkPaths(modpath, pathEntries(ManifestTypeWeapon, weaponPaths))
+	return data.Weapons, errors
+}
 
-	return modData, errors
+// WalkAmmunition reads the ammunition boxes in the given directories of a
+// mod, with the categories of the ammunition they hold.
+func WalkAmmunition(modpath string, ammunitionPaths, ammunitionBoxPaths []string) ([]CompleteAmmunition, []error) {
+	data, errors := walkPaths(modpath, append(
+		pathEntries(ManifestTypeAmmunition, ammunitionPaths),
+		pathEntries(ManifestTypeAmmunitionBox, ammunitionBoxPaths)...,
+	))
+	return data.Ammo, errors
 }
 
-func WalkModsDirectory(path string) ([]ModData, []error) {
-	// List the directory contents
-	files, err := ioutil.ReadDir(path)
+// WalkMod reads the data of a single mod, on its own.
+func WalkMod(modpath string) (ModData, []error) {
+	mod, err := loadMod(modpath)
 	if err != nil {
-		logrus.Errorf("error reading mods directory: %s", err)
-		return nil, []error{err}
+		return ModData{}, []error{err}
 	}
 
-	mods := []ModData{}
-	allErrors := []error{}
-	for _, file := range files {
-		// skip any raw files. They don't have anything we care about.
-		if !file.IsDir() {
-			continue
-		}
-
-		// skip the .git directories, if present.
-		if strings.Contains(file.Name(), ".git") {
-			continue
-		}
-
-		modData, errors := WalkMod(filepath.Join(path, file.Name()))
-		allErrors = append(allErrors, errors...)
-		mods = append(mods, modData)
-	}
+	modData, errors := walkMods([]loadedMod{mod})
+	return modData[0], errors
+}
 
-	return mods, allErrors
+// WalkModsDirectory reads the data of every mod in the mods directory, in load
+// order. Disabled mods are skipped unless includeDisabled is set. Where mods
+// define or merge into the same definition, the definition each mod ends up
+// with is the one the game would see.
+func WalkModsDirectory(path string, includeDisabled bool) ([]ModData, []error) {
+	mods, allErrors := readModsDirectory(path)
+	ordered, orderErrors := loadOrder(mods, includeDisabled)
+	allErrors = append(allErrors, orderErrors...)
+
+	modData, errors := walkMods(ordered)
+	return modData, append(allErrors, errors...)
 }
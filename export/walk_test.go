@@ -0,0 +1,66 @@
+package export
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWalkPaths(t *testing.T) {
+	modpath := filepath.Join(writeMods(t, map[string]string{
+		"A/chassis/chassisdef_atlas.json":       `{"Description": {"Id": "chassisdef_atlas", "Name": "Atlas"}, "VariantName": "AS7-D"}`,
+		"A/mech/mechdef_atlas.json":             `{"Description": {"Id": "mechdef_atlas"}, "ChassisID": "chassisdef_atlas"}`,
+		"A/weapon/Weapon_Laser.json":            weaponJSON("Weapon_Laser", 100, 20),
+		"A/gear/Gear_HeatSink.json":             `{"Description": {"Id": "Gear_HeatSink"}}`,
+		"A/jumpjet/Gear_JumpJet.json":           `{"Description": {"Id": "Gear_JumpJet"}, "JumpCapacity": 1}`,
+		"A/ammo/Ammunition_LRM.json":            `{"Description": {"Id": "Ammunition_LRM"}, "Category": "LRM"}`,
+		"A/ammobox/Ammo_AmmunitionBox_LRM.json": `{"Description": {"Id": "Ammo_AmmunitionBox_LRM"}, "AmmoID": "Ammunition_LRM"}`,
+	}), "A")
+
+	mechs, errs := WalkMechs(modpath, []string{"chassis"}, []string{"mech"})
+	if _, ok := mechs["Atlas_AS7-D"]; len(errs) != 0 || len(mechs) != 1 || !ok {
+		t.Errorf("WalkMechs got %v, %v", mechs, errs)
+	}
+	gear, errs := WalkGear(modpath, []string{"gear"})
+	if len(errs) != 0 || len(gear) != 1 || gear[0].Description.Id != "Gear_HeatSink" {
+		t.Errorf("WalkGear got %v, %v", gear, errs)
+	}
+	jumpjets, errs := WalkJumpJets(modpath, []string{"jumpjet"})
+	if len(errs) != 0 || len(jumpjets) != 1 || jumpjets[0].JumpCapacity != 1 {
+		t.Errorf("WalkJumpJets got %v, %v", jumpjets, errs)
+	}
+	weapons, errs := WalkWeapons(modpath, []string{"weapon"})
+	if len(errs) != 0 || len(weapons) != 1 || weapons[0].Damage != 20 {
+		t.Errorf("WalkWeapons got %v, %v", weapons, errs)
+	}
+	ammo, errs := WalkAmmunition(modpath, []string{"ammo"}, []string{"ammobox"})
+	if len(errs) != 0 || len(ammo) != 1 || ammo[0].Category != "LRM" {
+		t.Errorf("WalkAmmunition got %v, %v", ammo, errs)
+	}
+
+	if _, errs := WalkWeapons(modpath, []string{"missing"}); len(errs) != 1 {
+		t.Errorf("WalkWeapons of a missing directory got errors %v", errs)
+	}
+}
+
+func TestWalkErrorsNameFile(t *testing.T) {
+	modpath := filepath.Join(writeMods(t, map[string]string{
+		"A/weapon/Weapon_Broken.json":              `{"Description": `,
+		"A/ammo/Ammunition_Uncategorized.json":     `{"Description": {"Id": "Ammunition_Uncategorized"}}`,
+		"A/ammobox/Ammo_AmmunitionBox_Orphan.json": `{"Description": {"Id": "Ammo_AmmunitionBox_Orphan"}, "AmmoID": "Ammunition_Missing"}`,
+	}), "A")
+
+	_, errs := WalkWeapons(modpath, []string{"weapon"})
+	_, ammoErrs := WalkAmmunition(modpath, []string{"ammo"}, []string{"ammobox"})
+	errs = append(errs, ammoErrs...)
+
+	files := []string{"Weapon_Broken.json", "Ammunition_Uncategorized.json", "Ammo_AmmunitionBox_Orphan.json"}
+	if len(errs) != len(files) {
+		t.Fatalf("got errors %v, want one for each of %v", errs, files)
+	}
+	for i, file := range files {
+		if !strings.Contains(errs[i].Error(), file) {
+			t.Errorf("got error %q, want it to name %s", errs[i], file)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package importer
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Apply makes exactly the changes recorded in a previously written plan.
+// Before anything is written, every page is checked against the revision the
+// plan was made from, and pages that have been changed on the wiki since are
+// reported as conflicts and left alone. The plan's deletions are held to the
+// options' NoDelete, MaxDeletions, Force and Allowlist, just as an import's
+// are.
+func Apply(plan Plan, opts Options) error {
+	started := time.Now().UTC()
+
+	// the plan says which wiki and namespace it was made for. Refuse to
+	// apply it anywhere else.
+	if opts.URL == "" {
+		opts.URL = plan.Wiki
+	} else if opts.URL != plan.Wiki {
+		return fmt.Errorf("plan was made for %s, not %s", plan.Wiki, opts.URL)
+	}
+	if opts.Namespace == "" {
+		opts.Namespace = plan.Namespace
+	} else if normalizeTitle(opts.Namespace) != normalizeTitle(plan.Namespace) {
+		return fmt.Errorf("plan was made for namespace %s, not %s", plan.Namespace, opts.Namespace)
+	}
+	opts = opts.withDefaults()
+
+	w, err := newClient(opts)
+	if err != nil {
+		return err
+	}
+
+	if opts.DryRun {
+		logrus.Info("doing dry run, will not make alterations")
+	}
+
+	if err := w.startSession(); err != nil {
+		return err
+	}
+
+	// a dry run only warns about too many deletions, so its plan may hold
+	// deletions a real run would have refused.
+	plan, err = w.checkPlanDeletions(plan)
+	if err != nil {
+		return err
+	}
+
+	logrus.Infof("checking %d planned changes against the wiki", len(plan.Changes))
+	current, conflicts := w.checkPlan(plan)
+	logrus.Infof("%d changes are still current, %d conflict", len(current.Changes), len(conflicts))
+
+	if err := w.checkSession(); err != nil {
+		return fmt.Errorf("error checking session before making changes: %s", err)
+	}
+	report := w.execute(current)
+	report.Started = started
+	report.Failed = report.Failed + len(conflicts)
+	report.Pages = append(report.Pages, conflicts...)
+	sortResults(report.Pages)
+
+	if err := w.refreshReport(&report); err != nil {
+		return err
+	}
+	report.Finished = time.Now().UTC()
+
+	if opts.ReportOut != "" {
+		if err := writeJSONFile(opts.ReportOut, report); err != nil {
+			return fmt.Errorf("error writing report: %s", err)
+		}
+		logrus.Infof("wrote report to %s", opts.ReportOut)
+	}
+
+	return summarize(report)
+}
+
+// checkPlan fetches every page in the plan and compares it to the revision
+// the plan was made from. It returns the plan with only the changes that are
+// still safe to make, and a failed result for each change that is not.
+func (w *client) checkPlan(plan Plan) (Plan, []PageResult) {
+	var (
+		mu        sync.Mutex
+		current   []PlannedChange
+		conflicts []PageResult
+	)
+
+	w.inBatches(len(plan.Changes), func(i, j int) error {
+		changes := plan.Changes[i:j]
+
+		pages := []string{}
+		for _, change := range changes {
+			pages = append(pages, change.Page)
+		}
+
+		pageData, err := w.fetchPages(pages)
+
+		mu.Lock()
+		defer mu.Unlock()
+		for _, change := range changes {
+			if err != nil {
+				conflicts = append(conflicts, PageResult{
+					Page: change.Page, Action: change.Action, Error: err.Error(),
+				})
+				continue
+			}
+
+			rev := pageData[change.Page]
+			var conflict string
+			switch {
+			case change.Action == ActionCreate && !rev.Missing:
+				conflict = "page has been created since the plan was made"
+			case change.Action != ActionCreate && rev.Missing:
+				conflict = "page has been deleted since the plan was made"
+			case change.Action != ActionCreate && contentHash(rev.Content) != change.OldHash:
+				conflict = "page has been changed since the plan was made"
+			case change.BaseRevision != 0 && rev.RevID != change.BaseRevision:
+				// the content may have been changed and changed back, but
+				// the plan's diff was still made against another revision.
+				conflict = "page has been edited since the plan was made"
+			default:
+				conflict = w.manualEdit(rev)
+			}
+
+			if conflict != "" {
+				logrus.Warnf("CONFLICT %s: %s", change.Page, conflict)
+				conflicts = append(conflicts, PageResult{
+					Page: change.Page, Action: change.Action, Error: conflict,
+				})
+				continue
+			}
+			current = append(current, change)
+		}
+		return nil
+	})
+
+	sortChanges(current)
+	plan.Changes = current
+	return plan, conflicts
+}
+
+// checkPlanDeletions holds the plan's deletions to the options' safeguards,
+// the same as an import: deletions are dropped if NoDelete is set or the page
+// is on the allowlist, and the plan is refused if the rest would go over
+// MaxDeletions without Force. Deleting a page outside the namespace is always
+// refused.
+func (w *client) checkPlanDeletions(plan Plan) (Plan, error) {
+	prefix := normalizeTitle(w.opts.Namespace) + ":"
+	changes := []PlannedChange{}
+	deletions, skipped := 0, 0
+	for _, change := range plan.Changes {
+		if change.Action != ActionDelete {
+			changes = append(changes, change)
+			continue
+		}
+		page := normalizeTitle(change.Page)
+		if !strings.HasPrefix(page, prefix) {
+			return plan, fmt.Errorf("plan deletes %s, which is not in namespace %s", change.Page, w.opts.Namespace)
+		}
+		switch {
+		case w.opts.NoDelete:
+			skipped++
+		case w.opts.isProtected(strings.TrimPrefix(page, prefix)):
+			logrus.Infof("KEEP %s (allowlisted)", change.Page)
+		default:
+			changes = append(changes, change)
+			deletions++
+		}
+	}
+	if skipped > 0 {
+		logrus.Infof("not deleting %d pages the plan would delete", skipped)
+	}
+
+	if deletions > 0 && w.opts.MaxDeletions.Limited {
+		ids, err := GetExistingPages(w.Client, w.opts)
+		if err != nil {
+			return plan, fmt.Errorf("error listing existing pages to check the deletion limit: %s", err)
+		}
+		if err := w.opts.checkDeletionLimit(deletions, len(ids)); err != nil {
+			return plan, err
+		}
+	}
+
+	plan.Changes = changes
+	return plan, nil
+}
@@ -0,0 +1,158 @@
+package importer
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// dryRunPlan makes a plan of the import of testExport with a dry run, with
+// no deletion limit, and returns it.
+func dryRunPlan(t *testing.T, opts Options) Plan {
+	t.Helper()
+	opts.DryRun = true
+	opts.PlanOut = filepath.Join(t.TempDir(), "plan.json")
+	if _, err := importReport(t, testExport, opts); err != nil {
+		t.Fatalf("dry run failed: %s", err)
+	}
+	plan, err := LoadPlan(opts.PlanOut)
+	if err != nil {
+		t.Fatalf("error loading plan: %s", err)
+	}
+	return plan
+}
+
+func TestApply(t *testing.T) {
+	wiki, opts := newTestWiki(t)
+	setupExistingPages(wiki)
+	plan := dryRunPlan(t, opts)
+
+	if err := Apply(plan, opts); err != nil {
+		t.Fatalf("apply failed: %s", err)
+	}
+	if page, _ := wiki.Page("RawData:Changed"); page.Content() != "new" {
+		t.Errorf("RawData:Changed has content %q, want %q", page.Content(), "new")
+	}
+	if _, ok := wiki.Page("RawData:New"); !ok {
+		t.Errorf("RawData:New was not created")
+	}
+	if _, ok := wiki.Page("RawData:Unused"); ok {
+		t.Errorf("RawData:Unused was not deleted")
+	}
+}
+
+// TestApplyDeletionSafeguards checks that the deletions in a plan are held to
+// the same limits as an import, whatever the run that made the plan allowed.
+func TestApplyDeletionSafeguards(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		limit     string
+		force     bool
+		noDelete  bool
+		allowlist map[string]bool
+		wantErr   string
+		deleted   bool
+	}{
+		{name: "over the limit", limit: "0", wantErr: "refusing to continue without --force"},
+		{name: "over the percentage", limit: "0%", wantErr: "refusing to continue without --force"},
+		{name: "forced", limit: "0", force: true, deleted: true},
+		{name: "within the limit", limit: "1", deleted: true},
+		{name: "no delete", limit: "0", noDelete: true},
+		{name: "allowlisted", limit: "0", allowlist: map[string]bool{"Unused": true}},
+		{name: "allowlisted by page name", limit: "0", allowlist: map[string]bool{"RawData:Unused": true}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			wiki, opts := newTestWiki(t)
+			setupExistingPages(wiki)
+			plan := dryRunPlan(t, opts)
+
+			limit, err := ParseDeletionLimit(tc.limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			opts.MaxDeletions = limit
+			opts.Force = tc.force
+			opts.NoDelete = tc.noDelete
+			opts.Allowlist = tc.allowlist
+
+			err = Apply(plan, opts)
+			switch {
+			case tc.wantErr == "" && err != nil:
+				t.Fatalf("apply failed: %s", err)
+			case tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)):
+				t.Fatalf("got error %v, want %q", err, tc.wantErr)
+			case tc.wantErr != "" && wiki.Writes() != 0:
+				t.Errorf("refused plan made %d writes", wiki.Writes())
+			}
+
+			if _, ok := wiki.Page("RawData:Unused"); ok == tc.deleted {
+				t.Errorf("RawData:Unused exists: %v, want %v", ok, !tc.deleted)
+			}
+		})
+	}
+}
+
+func TestApplyOtherNamespace(t *testing.T) {
+	wiki, opts := newTestWiki(t)
+	setupExistingPages(wiki)
+	plan := dryRunPlan(t, opts)
+
+	opts.Namespace = "Main"
+	if err := Apply(plan, opts); err == nil {
+		t.Errorf("plan for namespace %s was applied to namespace %s", plan.Namespace, opts.Namespace)
+	}
+
+	// a plan edited to delete pages outside its namespace is refused too.
+	_, opts = newTestWiki(t)
+	opts.URL = plan.Wiki
+	plan.Changes = append(plan.Changes, PlannedChange{Page: "Main Page", Action: ActionDelete})
+	if err := Apply(plan, opts); err == nil {
+		t.Errorf("plan deleting Main Page was applied")
+	}
+	if _, ok := wiki.Page("Main Page"); !ok {
+		t.Errorf("Main Page was deleted")
+	}
+	if writes := wiki.Writes(); writes != 0 {
+		t.Errorf("refused plans made %d writes", writes)
+	}
+}
+
+func TestApplyConflicts(t *testing.T) {
+	wiki, opts := newTestWiki(t)
+	setupExistingPages(wiki)
+	wiki.SetPage("RawData:Other", "other", testUser)
+	plan := dryRunPlan(t, opts)
+
+	// RawData:Changed is edited and reverted, so its content is the same
+	// as when the plan was made but its revision is not. RawData:Unused is
+	// deleted, and RawData:New created, by someone else.
+	wiki.SetPage("RawData:Changed", "vandalism", testUser)
+	wiki.SetPage("RawData:Changed", "old", testUser)
+	wiki.SetPage("RawData:New", "written by hand", "Someone")
+	wiki.DeletePage("RawData:Unused")
+
+	opts.ReportOut = filepath.Join(t.TempDir(), "report.json")
+	err := Apply(plan, opts)
+	report := readReport(t, opts.ReportOut, err)
+	if err == nil {
+		t.Errorf("apply with conflicts succeeded")
+	}
+
+	want := map[string]string{
+		"RawData:Changed": "page has been edited since the plan was made",
+		"RawData:New":     "page has been created since the plan was made",
+		"RawData:Unused":  "page has been deleted since the plan was made",
+		"RawData:Other":   "",
+	}
+	for _, result := range report.Pages {
+		if result.Error != want[result.Page] {
+			t.Errorf("%s: got error %q, want %q", result.Page, result.Error, want[result.Page])
+		}
+	}
+	if report.Failed != 3 {
+		t.Errorf("got %d failed, want 3", report.Failed)
+	}
+	if page, _ := wiki.Page("RawData:Changed"); page.Content() != "old" {
+		t.Errorf("RawData:Changed was changed to %q", page.Content())
+	}
+}
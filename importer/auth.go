@@ -0,0 +1,185 @@
+package importer
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OAuth1Credentials are the keys of a MediaWiki OAuth 1.0a owner-only
+// consumer, which are issued together when the consumer is registered.
+type OAuth1Credentials struct {
+	ConsumerKey    string
+	ConsumerSecret string
+	AccessToken    string
+	AccessSecret   string
+}
+
+// usesOAuth returns true if requests are authenticated with OAuth rather
+// than by logging in.
+func (o Options) usesOAuth() bool {
+	return o.OAuth1 != nil || o.OAuth2Token != ""
+}
+
+// hasCredentials returns true if the options hold any way to authenticate.
+func (o Options) hasCredentials() bool {
+	return o.Username != "" || o.usesOAuth()
+}
+
+// withOAuth returns a transport that sends requests through base, adding the
+// OAuth credentials in the options to those for the wiki's host. Without
+// OAuth credentials, base is returned as is.
+func withOAuth(base http.RoundTripper, opts Options) (http.RoundTripper, error) {
+	if !opts.usesOAuth() {
+		return base, nil
+	}
+	wiki, err := url.Parse(opts.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid wiki url %s: %s", opts.URL, err)
+	}
+
+	return &oauthTransport{
+		base:   base,
+		host:   wiki.Host,
+		oauth1: opts.OAuth1,
+		oauth2: opts.OAuth2Token,
+	}, nil
+}
+
+// oauthTransport signs requests to one host with OAuth 1.0a, or adds an
+// OAuth 2.0 bearer token to them.
+type oauthTransport struct {
+	base   http.RoundTripper
+	host   string
+	oauth1 *OAuth1Credentials
+	oauth2 string
+}
+
+func (t *oauthTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Host != t.host {
+		return t.base.RoundTrip(req)
+	}
+
+	// a RoundTripper must not change the request it was given.
+	signed := req.Clone(req.Context())
+	if t.oauth2 != "" {
+		signed.Header.Set("Authorization", "Bearer "+t.oauth2)
+		return t.base.RoundTrip(signed)
+	}
+
+	// form encoded bodies are part of the OAuth 1.0a signature, so they have
+	// to be read, and put back for sending.
+	var form url.Values
+	if req.Body != nil && strings.HasPrefix(req.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		body, err := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		if form, err = url.ParseQuery(string(body)); err != nil {
+			return nil, err
+		}
+		signed.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	signed.Header.Set("Authorization", t.oauth1.authorization(signed.Method, signed.URL, form))
+	return t.base.RoundTrip(signed)
+}
+
+// authorization returns the Authorization header for a request, signed as
+// described in RFC 5849.
+func (c *OAuth1Credentials) authorization(method string, u *url.URL, form url.Values) string {
+	nonce := make([]byte, 16)
+	rand.Read(nonce)
+
+	oauth := map[string]string{
+		"oauth_consumer_key":     c.ConsumerKey,
+		"oauth_token":            c.AccessToken,
+		"oauth_signature_method": "HMAC-SHA1",
+		"oauth_timestamp":        strconv.FormatInt(time.Now().Unix(), 10),
+		"oauth_nonce":            hex.EncodeToString(nonce),
+		"oauth_version":          "1.0",
+	}
+	oauth["oauth_signature"] = c.signature(signatureBaseString(method, u, form, oauth))
+
+	header := []string{}
+	for k, v := range oauth {
+		header = append(header, fmt.Sprintf("%s=%q", oauthEscape(k), oauthEscape(v)))
+	}
+	sort.Strings(header)
+	return "OAuth " + strings.Join(header, ", ")
+}
+
+// signatureBaseString returns the string a request with the given form body
+// and oauth parameters is signed by, as described in section 3.4.1 of RFC
+// 5849.
+func signatureBaseString(method string, u *url.URL, form url.Values, oauth map[string]string) string {
+	// every query, form and oauth parameter is signed, encoded and sorted.
+	params := [][2]string{}
+	add := func(values url.Values) {
+		for k, vs := range values {
+			for _, v := range vs {
+				params = append(params, [2]string{oauthEscape(k), oauthEscape(v)})
+			}
+		}
+	}
+	add(u.Query())
+	add(form)
+	for k, v := range oauth {
+		params = append(params, [2]string{oauthEscape(k), oauthEscape(v)})
+	}
+	sort.Slice(params, func(i, j int) bool {
+		if params[i][0] != params[j][0] {
+			return params[i][0] < params[j][0]
+		}
+		return params[i][1] < params[j][1]
+	})
+	pairs := make([]string, len(params))
+	for i, p := range params {
+		pairs[i] = p[0] + "=" + p[1]
+	}
+
+	baseURL := *u
+	baseURL.RawQuery = ""
+	baseURL.Fragment = ""
+	baseURL.Scheme = strings.ToLower(baseURL.Scheme)
+	baseURL.Host = strings.ToLower(baseURL.Host)
+
+	return strings.ToUpper(method) + "&" +
+		oauthEscape(baseURL.String()) + "&" +
+		oauthEscape(strings.Join(pairs, "&"))
+}
+
+// signature returns the HMAC-SHA1 signature of a signature base string.
+func (c *OAuth1Credentials) signature(baseString string) string {
+	key := oauthEscape(c.ConsumerSecret) + "&" + oauthEscape(c.AccessSecret)
+	mac := hmac.New(sha1.New, []byte(key))
+	mac.Write([]byte(baseString))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// oauthEscape percent encodes everything but the characters RFC 3986 leaves
+// unreserved, as OAuth requires.
+func oauthEscape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') ||
+			c == '-' || c == '.' || c == '_' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
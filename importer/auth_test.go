@@ -0,0 +1,149 @@
+package importer
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestSignatureBaseString(t *testing.T) {
+	// the example request of section 3.4.1.1 of RFC 5849.
+	u, err := url.Parse("http://example.com/request?b5=%3D%253D&a3=a&c%40=&a2=r%20b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	form, err := url.ParseQuery("c2&a3=2+q")
+	if err != nil {
+		t.Fatal(err)
+	}
+	oauth := map[string]string{
+		"oauth_consumer_key":     "9djdj82h48djs9d2",
+		"oauth_token":            "kkk9d7dh3k39sjv7",
+		"oauth_signature_method": "HMAC-SHA1",
+		"oauth_timestamp":        "137131201",
+		"oauth_nonce":            "7d8f3e4a",
+	}
+
+	want := "POST&http%3A%2F%2Fexample.com%2Frequest&a2%3Dr%2520b%26a3%3D2%2520q" +
+		"%26a3%3Da%26b5%3D%253D%25253D%26c%2540%3D%26c2%3D%26oauth_consumer_" +
+		"key%3D9djdj82h48djs9d2%26oauth_nonce%3D7d8f3e4a%26oauth_signature_m" +
+		"ethod%3DHMAC-SHA1%26oauth_timestamp%3D137131201%26oauth_token%3Dkkk" +
+		"9d7dh3k39sjv7"
+	if got := signatureBaseString("post", u, form, oauth); got != want {
+		t.Errorf("got base string\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestSignature(t *testing.T) {
+	// the example request of section 1.2 of RFC 5849.
+	u, err := url.Parse("http://photos.example.net/photos?file=vacation.jpg&size=original")
+	if err != nil {
+		t.Fatal(err)
+	}
+	credentials := &OAuth1Credentials{
+		ConsumerKey:    "dpf43f3p2l4k3l03",
+		ConsumerSecret: "kd94hf93k423kf44",
+		AccessToken:    "nnch734d00sl2jdk",
+		AccessSecret:   "pfkkdhi9sl3r4s00",
+	}
+	oauth := map[string]string{
+		"oauth_consumer_key":     credentials.ConsumerKey,
+		"oauth_token":            credentials.AccessToken,
+		"oauth_signature_method": "HMAC-SHA1",
+		"oauth_timestamp":        "137131202",
+		"oauth_nonce":            "chapoH",
+	}
+
+	want := "MdpQcU8iPSUjWoN/UDMsK2sui9I="
+	if got := credentials.signature(signatureBaseString("GET", u, nil, oauth)); got != want {
+		t.Errorf("got signature %s, want %s", got, want)
+	}
+}
+
+// authorizations starts a server that records the Authorization header and
+// body of every request it gets.
+func authorizations(t *testing.T) (*httptest.Server, *[]string, *[]string) {
+	t.Helper()
+	var headers, bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		headers = append(headers, r.Header.Get("Authorization"))
+		bodies = append(bodies, string(body))
+	}))
+	t.Cleanup(server.Close)
+	return server, &headers, &bodies
+}
+
+func TestOAuthTransport(t *testing.T) {
+	wiki, headers, bodies := authorizations(t)
+	other, otherHeaders, _ := authorizations(t)
+
+	for _, tc := range []struct {
+		name   string
+		opts   Options
+		prefix string
+	}{
+		{
+			name: "oauth1",
+			opts: Options{OAuth1: &OAuth1Credentials{
+				ConsumerKey: "key", ConsumerSecret: "secret", AccessToken: "token", AccessSecret: "secret",
+			}},
+			prefix: "OAuth ",
+		},
+		{
+			name:   "oauth2",
+			opts:   Options{OAuth2Token: "bearer-token"},
+			prefix: "Bearer bearer-token",
+		},
+	} {
+		*headers, *bodies, *otherHeaders = nil, nil, nil
+		tc.opts.URL = wiki.URL + "/api.php"
+		w, err := newClient(tc.opts.withDefaults())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		form := url.Values{"action": {"edit"}, "text": {"a & b"}}
+		resp, err := w.httpc.PostForm(tc.opts.URL, form)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if len(*headers) != 1 || !strings.HasPrefix((*headers)[0], tc.prefix) {
+			t.Errorf("%s: wiki got authorization %q, want %q...", tc.name, *headers, tc.prefix)
+		}
+		if tc.prefix == "OAuth " && !strings.Contains((*headers)[0], "oauth_signature=") {
+			t.Errorf("%s: authorization %q is not signed", tc.name, (*headers)[0])
+		}
+		if len(*bodies) != 1 || (*bodies)[0] != form.Encode() {
+			t.Errorf("%s: wiki got body %q, want %q", tc.name, *bodies, form.Encode())
+		}
+
+		// the credentials go to the wiki, and nowhere else.
+		resp, err = w.httpc.Get(other.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if len(*otherHeaders) != 1 || (*otherHeaders)[0] != "" {
+			t.Errorf("%s: another host got authorization %q", tc.name, *otherHeaders)
+		}
+
+		// nor do requests made outside the importer carry them.
+		*headers = nil
+		resp, err = http.Get(wiki.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if (*headers)[0] != "" {
+			t.Errorf("%s: request through the default client got authorization %q", tc.name, (*headers)[0])
+		}
+		if _, ok := http.DefaultTransport.(*oauthTransport); ok {
+			t.Errorf("%s: http.DefaultTransport was replaced", tc.name)
+		}
+	}
+}
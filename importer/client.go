@@ -0,0 +1,162 @@
+package importer
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"cgt.name/pkg/go-mwclient"
+	"github.com/sirupsen/logrus"
+)
+
+// client is a wiki client shared by every worker of an import run. Each call
+// made through it waits on the rate limiter and is retried according to the
+// run's retry policy.
+type client struct {
+	*mwclient.Client
+	// httpc makes every request of the run, including those mwclient
+	// cannot make for us, like uploads.
+	httpc   *http.Client
+	opts    Options
+	limiter *RateLimiter
+	// journal, if not nil, records every page operation completed.
+	journal *Journal
+
+	// session is held for reading by every request, and for writing while
+	// logging in, so that no request is made with a half replaced session.
+	session sync.RWMutex
+	// generation counts logins, so that workers that hit an expired session
+	// at the same time only log in again once.
+	generation int
+	loggedIn   bool
+	// user is the name the wiki records our edits under, once logged in.
+	user string
+}
+
+func newClient(opts Options) (*client, error) {
+	w, err := mwclient.New(opts.URL, "")
+	if err != nil {
+		return nil, err
+	}
+
+	// the run's requests carry its credentials, but nothing else in the
+	// process does.
+	transport, err := withOAuth(http.DefaultTransport, opts)
+	if err != nil {
+		return nil, err
+	}
+	limiter := NewRateLimiter(opts.RequestsPerSecond, opts.Concurrency)
+	httpc := &http.Client{
+		Transport: throttleTransport{base: transport, limiter: limiter},
+		Timeout:   30 * time.Second,
+	}
+	// mwclient keeps its cookie jar, so the session is shared with httpc.
+	w.SetHTTPClient(httpc)
+
+	return &client{
+		Client:  w,
+		httpc:   httpc,
+		opts:    opts,
+		limiter: limiter,
+	}, nil
+}
+
+// call runs f, which should make a single API request, until it succeeds or
+// the retry policy gives up. what describes the request for logging. If the
+// request fails because the session expired, we log in again before the
+// retry.
+func (c *client) call(what string, f func() error) error {
+	return c.opts.Retry.Do(what, func() error {
+		c.limiter.Wait()
+
+		c.session.RLock()
+		generation, loggedIn := c.generation, c.loggedIn
+		err := f()
+		c.session.RUnlock()
+
+		if delay, ok := estimateThrottleDelay(err); ok {
+			logrus.Warnf("wiki asked us to slow down, pausing requests for at least %s", delay)
+			c.limiter.Pause(delay)
+		}
+		if loggedIn && sessionErrors[apiErrorCode(err)] {
+			logrus.Warnf("session expired %s: %s", what, err)
+			if loginErr := c.relogin(generation); loginErr != nil {
+				return fmt.Errorf("%s, and could not log in again: %w", err, loginErr)
+			}
+		}
+		return err
+	})
+}
+
+// addWriteParameters adds the parameters every write request carries, as
+// set by the options. The bot and minor flags only apply to edits.
+func (o Options) addWriteParameters(parameters map[string]string, edit bool) {
+	if edit && o.BotEdit {
+		parameters["bot"] = "1"
+	}
+	if edit && o.MinorEdit {
+		parameters["minor"] = "1"
+	}
+	if len(o.Tags) > 0 {
+		parameters["tags"] = strings.Join(o.Tags, "|")
+	}
+	if o.MaxLag > 0 {
+		parameters["maxlag"] = strconv.Itoa(o.MaxLag)
+	}
+}
+
+// inBatches splits count items into batches of at most BATCH_SIZE, and calls
+// fn with the bounds of each batch, running as many batches at once as the
+// options allow. Once every batch is done, it returns the first error any of
+// them returned.
+func (w *client) inBatches(count int, fn func(lo, hi int) error) error {
+	var (
+		mu       sync.Mutex
+		firstErr error
+	)
+	batches := (count + BATCH_SIZE - 1) / BATCH_SIZE
+	parallel(w.opts.Concurrency, batches, func(batch int) {
+		lo := batch * BATCH_SIZE
+		hi := lo + BATCH_SIZE
+		if hi > count {
+			hi = count
+		}
+		if err := fn(lo, hi); err != nil {
+			mu.Lock()
+			defer mu.Unlock()
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	})
+	return firstErr
+}
+
+// parallel calls f with every index from 0 to count-1, running at most
+// workers calls at once, and returns when all calls are done.
+func parallel(workers, count int, f func(i int)) {
+	if workers < 1 {
+		workers = 1
+	}
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for n := 0; n < workers; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				f(i)
+			}
+		}()
+	}
+
+	for i := 0; i < count; i++ {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+}
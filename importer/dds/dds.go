@@ -0,0 +1,310 @@
+// Package dds decodes DirectDraw Surface images, the format most BattleTech
+// icons ship in. It handles DXT1, DXT3 and DXT5 compressed surfaces and
+// uncompressed RGB and RGBA surfaces, which covers the icons found in mods.
+// Only the top mipmap level is decoded.
+//
+// Importing this package registers the format with the image package, so
+// image.Decode can read DDS files.
+package dds
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math/bits"
+)
+
+const (
+	magic      = "DDS "
+	headerSize = 124
+
+	// pixel format flags
+	flagAlphaPixels = 0x1
+	flagFourCC      = 0x4
+	flagRGB         = 0x40
+
+	// maxDimension is the largest width or height decoded. Icons are far
+	// smaller; the limit keeps a corrupt header from allocating gigabytes.
+	maxDimension = 4096
+)
+
+// blockSizes maps each supported compression to the size of its 4x4 blocks.
+var blockSizes = map[string]int{
+	"DXT1": 8,
+	"DXT3": 16,
+	"DXT5": 16,
+}
+
+func init() {
+	image.RegisterFormat("dds", magic, Decode, DecodeConfig)
+}
+
+type header struct {
+	height, width uint32
+	pfFlags       uint32
+	fourCC        string
+	rgbBitCount   uint32
+	masks         [4]uint32 // r, g, b, a
+}
+
+func readHeader(r io.Reader) (header, error) {
+	var h header
+
+	buf := make([]byte, 4+headerSize)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return h, fmt.Errorf("dds: error reading header: %s", err)
+	}
+	if string(buf[:4]) != magic {
+		return h, fmt.Errorf("dds: not a DDS file")
+	}
+	le := binary.LittleEndian
+	if le.Uint32(buf[4:]) != headerSize {
+		return h, fmt.Errorf("dds: invalid header size %d", le.Uint32(buf[4:]))
+	}
+
+	h.height = le.Uint32(buf[12:])
+	h.width = le.Uint32(buf[16:])
+	h.pfFlags = le.Uint32(buf[80:])
+	h.fourCC = string(buf[84:88])
+	h.rgbBitCount = le.Uint32(buf[88:])
+	for i := range h.masks {
+		h.masks[i] = le.Uint32(buf[92+4*i:])
+	}
+
+	if h.pfFlags&flagFourCC != 0 && h.fourCC == "DX10" {
+		return h, fmt.Errorf("dds: DX10 surfaces are not supported")
+	}
+	if h.width == 0 || h.height == 0 || h.width > maxDimension || h.height > maxDimension {
+		return h, fmt.Errorf("dds: unsupported dimensions %dx%d", h.width, h.height)
+	}
+	return h, nil
+}
+
+// dataSize returns the number of bytes in the top mipmap level of the image.
+func (h header) dataSize() (int, error) {
+	width, height := int(h.width), int(h.height)
+	switch {
+	case h.pfFlags&flagFourCC != 0:
+		blockSize, ok := blockSizes[h.fourCC]
+		if !ok {
+			return 0, fmt.Errorf("dds: unsupported compression %q", h.fourCC)
+		}
+		return ((width + 3) / 4) * ((height + 3) / 4) * blockSize, nil
+	case h.pfFlags&flagRGB != 0:
+		bytesPerPixel := int(h.rgbBitCount / 8)
+		if bytesPerPixel < 1 || bytesPerPixel > 4 {
+			return 0, fmt.Errorf("dds: unsupported bit count %d", h.rgbBitCount)
+		}
+		return width * height * bytesPerPixel, nil
+	default:
+		return 0, fmt.Errorf("dds: unsupported pixel format")
+	}
+}
+
+// DecodeConfig returns the dimensions and color model of a DDS image without
+// decoding the pixels.
+func DecodeConfig(r io.Reader) (image.Config, error) {
+	h, err := readHeader(r)
+	if err != nil {
+		return image.Config{}, err
+	}
+	return image.Config{
+		ColorModel: color.NRGBAModel,
+		Width:      int(h.width),
+		Height:     int(h.height),
+	}, nil
+}
+
+// Decode reads the top mipmap level of a DDS image.
+func Decode(r io.Reader) (image.Image, error) {
+	h, err := readHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	// only the top mipmap level is read, and only once the header has been
+	// checked, so nothing is allocated for a file that cannot be decoded.
+	size, err := h.dataSize()
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, fmt.Errorf("dds: truncated pixel data: %s", err)
+	}
+
+	img := image.NewNRGBA(image.Rect(0, 0, int(h.width), int(h.height)))
+
+	switch {
+	case h.pfFlags&flagFourCC != 0:
+		blockSize := blockSizes[h.fourCC]
+		decodeBlock := decodeDXT1
+		switch h.fourCC {
+		case "DXT3":
+			decodeBlock = decodeDXT3
+		case "DXT5":
+			decodeBlock = decodeDXT5
+		}
+
+		blocksWide := (int(h.width) + 3) / 4
+		blocksHigh := (int(h.height) + 3) / 4
+		for by := 0; by < blocksHigh; by++ {
+			for bx := 0; bx < blocksWide; bx++ {
+				offset := (by*blocksWide + bx) * blockSize
+				decodeBlock(img, data[offset:offset+blockSize], bx*4, by*4)
+			}
+		}
+	default:
+		decodeUncompressed(img, h, data)
+	}
+
+	return img, nil
+}
+
+// decodeUncompressed reads pixels laid out one after another, pulling each
+// channel out with the masks from the header. data must hold every pixel.
+func decodeUncompressed(img *image.NRGBA, h header, data []byte) {
+	bytesPerPixel := int(h.rgbBitCount / 8)
+	width, height := int(h.width), int(h.height)
+
+	hasAlpha := h.pfFlags&flagAlphaPixels != 0
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			offset := (y*width + x) * bytesPerPixel
+			var pixel uint32
+			for i := 0; i < bytesPerPixel; i++ {
+				pixel = pixel | uint32(data[offset+i])<<(8*i)
+			}
+
+			c := color.NRGBA{
+				R: channel(pixel, h.masks[0]),
+				G: channel(pixel, h.masks[1]),
+				B: channel(pixel, h.masks[2]),
+				A: 255,
+			}
+			if hasAlpha {
+				c.A = channel(pixel, h.masks[3])
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+}
+
+// channel extracts the bits of pixel under mask and scales them to 8 bits.
+func channel(pixel, mask uint32) uint8 {
+	if mask == 0 {
+		return 0
+	}
+	shift := bits.TrailingZeros32(mask)
+	width := bits.OnesCount32(mask)
+	value := (pixel & mask) >> uint(shift)
+	max := uint32(1)<<uint(width) - 1
+	return uint8(value * 255 / max)
+}
+
+// rgb565 expands a 16 bit 5:6:5 color to 8 bits per channel.
+func rgb565(c uint16) color.NRGBA {
+	r := uint8(c >> 11 & 0x1f)
+	g := uint8(c >> 5 & 0x3f)
+	b := uint8(c & 0x1f)
+	return color.NRGBA{
+		R: r<<3 | r>>2,
+		G: g<<2 | g>>4,
+		B: b<<3 | b>>2,
+		A: 255,
+	}
+}
+
+func mix(a, b uint8, wa, wb int) uint8 {
+	return uint8((int(a)*wa + int(b)*wb) / (wa + wb))
+}
+
+// colorPalette returns the four colors of a DXT color block. DXT1 blocks
+// whose first color is not greater than the second use three colors and
+// transparent black; DXT3 and DXT5 blocks always use four colors.
+func colorPalette(block []byte, allowTransparent bool) [4]color.NRGBA {
+	c0 := binary.LittleEndian.Uint16(block[0:])
+	c1 := binary.LittleEndian.Uint16(block[2:])
+	p := [4]color.NRGBA{rgb565(c0), rgb565(c1)}
+
+	if c0 > c1 || !allowTransparent {
+		p[2] = color.NRGBA{
+			R: mix(p[0].R, p[1].R, 2, 1),
+			G: mix(p[0].G, p[1].G, 2, 1),
+			B: mix(p[0].B, p[1].B, 2, 1),
+			A: 255,
+		}
+		p[3] = color.NRGBA{
+			R: mix(p[0].R, p[1].R, 1, 2),
+			G: mix(p[0].G, p[1].G, 1, 2),
+			B: mix(p[0].B, p[1].B, 1, 2),
+			A: 255,
+		}
+	} else {
+		p[2] = color.NRGBA{
+			R: mix(p[0].R, p[1].R, 1, 1),
+			G: mix(p[0].G, p[1].G, 1, 1),
+			B: mix(p[0].B, p[1].B, 1, 1),
+			A: 255,
+		}
+		p[3] = color.NRGBA{}
+	}
+	return p
+}
+
+// setBlock writes a 4x4 block of pixels at x, y, clipping to the image. alpha
+// returns the alpha of pixel i of the block, or nil to keep the palette's.
+func setBlock(img *image.NRGBA, colors []byte, palette [4]color.NRGBA, x, y int, alpha func(i int) uint8) {
+	indices := binary.LittleEndian.Uint32(colors[4:])
+	bounds := img.Bounds()
+	for i := 0; i < 16; i++ {
+		px, py := x+i%4, y+i/4
+		if px >= bounds.Max.X || py >= bounds.Max.Y {
+			continue
+		}
+		c := palette[indices>>(2*uint(i))&0x3]
+		if alpha != nil {
+			c.A = alpha(i)
+		}
+		img.SetNRGBA(px, py, c)
+	}
+}
+
+func decodeDXT1(img *image.NRGBA, block []byte, x, y int) {
+	setBlock(img, block, colorPalette(block, true), x, y, nil)
+}
+
+func decodeDXT3(img *image.NRGBA, block []byte, x, y int) {
+	alphas := binary.LittleEndian.Uint64(block[0:])
+	setBlock(img, block[8:], colorPalette(block[8:], false), x, y, func(i int) uint8 {
+		a := uint8(alphas >> (4 * uint(i)) & 0xf)
+		return a<<4 | a
+	})
+}
+
+func decodeDXT5(img *image.NRGBA, block []byte, x, y int) {
+	a0, a1 := block[0], block[1]
+	var palette [8]uint8
+	palette[0], palette[1] = a0, a1
+	if a0 > a1 {
+		for i := 1; i < 7; i++ {
+			palette[i+1] = mix(a0, a1, 7-i, i)
+		}
+	} else {
+		for i := 1; i < 5; i++ {
+			palette[i+1] = mix(a0, a1, 5-i, i)
+		}
+		palette[6], palette[7] = 0, 255
+	}
+
+	// the 16 alpha indices are packed 3 bits each into the next 6 bytes.
+	var indices uint64
+	for i := 0; i < 6; i++ {
+		indices = indices | uint64(block[2+i])<<(8*uint(i))
+	}
+
+	setBlock(img, block[8:], colorPalette(block[8:], false), x, y, func(i int) uint8 {
+		return palette[indices>>(3*uint(i))&0x7]
+	})
+}
@@ -0,0 +1,142 @@
+package dds
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+)
+
+// ddsHeader returns the magic and header of a DDS file.
+func ddsHeader(width, height, pfFlags uint32, fourCC string, bitCount uint32, masks [4]uint32) []byte {
+	buf := make([]byte, 4+headerSize)
+	copy(buf, magic)
+	le := binary.LittleEndian
+	le.PutUint32(buf[4:], headerSize)
+	le.PutUint32(buf[12:], height)
+	le.PutUint32(buf[16:], width)
+	le.PutUint32(buf[80:], pfFlags)
+	copy(buf[84:88], fourCC)
+	le.PutUint32(buf[88:], bitCount)
+	for i, mask := range masks {
+		le.PutUint32(buf[92+4*i:], mask)
+	}
+	return buf
+}
+
+var rgbaMasks = [4]uint32{0x000000ff, 0x0000ff00, 0x00ff0000, 0xff000000}
+
+func TestDecodeUncompressed(t *testing.T) {
+	file := ddsHeader(2, 1, flagRGB|flagAlphaPixels, "", 32, rgbaMasks)
+	file = append(file, 0xff, 0x00, 0x00, 0xff, 0x00, 0x80, 0xff, 0x40)
+
+	img, format, err := image.Decode(bytes.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format != "dds" {
+		t.Errorf("decoded as %s, not dds", format)
+	}
+	want := []color.NRGBA{{R: 0xff, A: 0xff}, {G: 0x80, B: 0xff, A: 0x40}}
+	for x, c := range want {
+		if got := img.At(x, 0); got != c {
+			t.Errorf("pixel %d: got %v, want %v", x, got, c)
+		}
+	}
+}
+
+func TestDecodeDXT1(t *testing.T) {
+	// a 4x4 block of pure red, 0xf800 in 5:6:5, with every index 0. The
+	// image is smaller than the block, which is clipped.
+	file := ddsHeader(3, 2, flagFourCC, "DXT1", 0, [4]uint32{})
+	file = append(file, 0x00, 0xf8, 0x00, 0x00, 0, 0, 0, 0)
+
+	img, err := Decode(bytes.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bounds := img.Bounds(); bounds.Dx() != 3 || bounds.Dy() != 2 {
+		t.Errorf("got bounds %v, want 3x2", bounds)
+	}
+	red := color.NRGBA{R: 0xff, A: 0xff}
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 3; x++ {
+			if got := img.At(x, y); got != red {
+				t.Errorf("pixel %d,%d: got %v, want %v", x, y, got, red)
+			}
+		}
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		file []byte
+		want string
+	}{
+		{
+			name: "not dds",
+			file: append([]byte("PNG "), make([]byte, headerSize)...),
+			want: "not a DDS file",
+		},
+		{
+			name: "short header",
+			file: []byte(magic),
+			want: "error reading header",
+		},
+		{
+			name: "zero width",
+			file: ddsHeader(0, 4, flagRGB, "", 32, rgbaMasks),
+			want: "unsupported dimensions",
+		},
+		{
+			name: "zero height",
+			file: ddsHeader(4, 0, flagRGB, "", 32, rgbaMasks),
+			want: "unsupported dimensions",
+		},
+		{
+			// a header this size would need 16GiB of pixels, and must be
+			// refused before anything is allocated for them.
+			name: "too large",
+			file: ddsHeader(1<<16, 1<<16, flagRGB, "", 32, rgbaMasks),
+			want: "unsupported dimensions",
+		},
+		{
+			name: "truncated compressed",
+			file: append(ddsHeader(8, 8, flagFourCC, "DXT5", 0, [4]uint32{}), make([]byte, 63)...),
+			want: "truncated pixel data",
+		},
+		{
+			name: "truncated uncompressed",
+			file: append(ddsHeader(2, 2, flagRGB, "", 24, rgbaMasks), make([]byte, 11)...),
+			want: "truncated pixel data",
+		},
+		{
+			name: "unsupported compression",
+			file: ddsHeader(4, 4, flagFourCC, "ATI2", 0, [4]uint32{}),
+			want: "unsupported compression",
+		},
+		{
+			name: "dx10",
+			file: ddsHeader(4, 4, flagFourCC, "DX10", 0, [4]uint32{}),
+			want: "DX10 surfaces are not supported",
+		},
+		{
+			name: "unsupported bit count",
+			file: ddsHeader(4, 4, flagRGB, "", 40, rgbaMasks),
+			want: "unsupported bit count",
+		},
+		{
+			name: "unsupported pixel format",
+			file: ddsHeader(4, 4, 0, "", 0, [4]uint32{}),
+			want: "unsupported pixel format",
+		},
+	} {
+		_, err := Decode(bytes.NewReader(tc.file))
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: got error %v, want %q", tc.name, err, tc.want)
+		}
+	}
+}
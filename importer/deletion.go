@@ -0,0 +1,126 @@
+package importer
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// DeletionLimit bounds how many pages a single import may delete. The zero
+// value allows any number of deletions.
+type DeletionLimit struct {
+	// Limited is false for a limit that allows any number of deletions.
+	Limited bool
+	// Count is the absolute number of pages that may be deleted.
+	Count int
+	// Percent is the share, from 0 to 100, of the existing pages that may be
+	// deleted. It is used instead of Count if IsPercent is set.
+	Percent   float64
+	IsPercent bool
+}
+
+// ParseDeletionLimit parses a limit given either as an absolute count, like
+// "50", or as a percentage of existing pages, like "10%". A limit of "0" or
+// "0%" allows no deletions at all. The empty string is no limit.
+func ParseDeletionLimit(s string) (DeletionLimit, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return DeletionLimit{}, nil
+	}
+
+	if strings.HasSuffix(s, "%") {
+		percent, err := strconv.ParseFloat(strings.TrimSuffix(s, "%"), 64)
+		if err != nil || percent < 0 || percent > 100 {
+			return DeletionLimit{}, fmt.Errorf("invalid deletion percentage %q", s)
+		}
+		return DeletionLimit{Limited: true, Percent: percent, IsPercent: true}, nil
+	}
+
+	count, err := strconv.Atoi(s)
+	if err != nil || count < 0 {
+		return DeletionLimit{}, fmt.Errorf("invalid deletion count %q", s)
+	}
+	return DeletionLimit{Limited: true, Count: count}, nil
+}
+
+// Exceeded returns true if deleting the given number of pages, out of the
+// given number of existing pages, would go over the limit.
+func (l DeletionLimit) Exceeded(deletions, existing int) bool {
+	switch {
+	case !l.Limited:
+		return false
+	case l.IsPercent && existing == 0:
+		// there is nothing to take a share of, so any deletion is too many.
+		return deletions > 0
+	case l.IsPercent:
+		return float64(deletions)*100/float64(existing) > l.Percent
+	default:
+		return deletions > l.Count
+	}
+}
+
+func (l DeletionLimit) String() string {
+	switch {
+	case !l.Limited:
+		return "unlimited"
+	case l.IsPercent:
+		return fmt.Sprintf("%v%%", l.Percent)
+	default:
+		return fmt.Sprint(l.Count)
+	}
+}
+
+// checkDeletionLimit returns an error if deleting the given number of pages,
+// out of the given number of existing pages, would go over MaxDeletions and
+// Force is not set. A dry run only warns.
+func (o Options) checkDeletionLimit(deletions, existing int) error {
+	if !o.MaxDeletions.Exceeded(deletions, existing) {
+		return nil
+	}
+	msg := fmt.Sprintf(
+		"%d of %d existing pages would be deleted, over the limit of %s",
+		deletions, existing, o.MaxDeletions,
+	)
+	switch {
+	case o.DryRun:
+		logrus.Warnf("%s; a real run would abort without --force", msg)
+	case o.Force:
+		logrus.Warnf("%s; continuing because of --force", msg)
+	default:
+		return fmt.Errorf("%s; refusing to continue without --force", msg)
+	}
+	return nil
+}
+
+// LoadAllowlist reads a file of page names that must never be deleted, one
+// per line. Blank lines and lines starting with # are ignored. Names may be
+// given with or without the namespace prefix.
+func LoadAllowlist(path string) (map[string]bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	allowlist := map[string]bool{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		allowlist[normalizeTitle(line)] = true
+	}
+
+	return allowlist, scanner.Err()
+}
+
+// isProtected returns true if the page with the given title is on the
+// allowlist, under either its bare title or its full page name.
+func (o Options) isProtected(title string) bool {
+	return o.Allowlist[normalizeTitle(title)] || o.Allowlist[normalizeTitle(o.pageName(title))]
+}
@@ -0,0 +1,94 @@
+package importer
+
+import "testing"
+
+func TestParseDeletionLimit(t *testing.T) {
+	for _, tc := range []struct {
+		in      string
+		want    DeletionLimit
+		wantErr bool
+	}{
+		{in: "", want: DeletionLimit{}},
+		{in: "  ", want: DeletionLimit{}},
+		{in: "0", want: DeletionLimit{Limited: true}},
+		{in: "50", want: DeletionLimit{Limited: true, Count: 50}},
+		{in: " 7 ", want: DeletionLimit{Limited: true, Count: 7}},
+		{in: "0%", want: DeletionLimit{Limited: true, IsPercent: true}},
+		{in: "10%", want: DeletionLimit{Limited: true, Percent: 10, IsPercent: true}},
+		{in: "2.5%", want: DeletionLimit{Limited: true, Percent: 2.5, IsPercent: true}},
+		{in: "100%", want: DeletionLimit{Limited: true, Percent: 100, IsPercent: true}},
+		{in: "-1", wantErr: true},
+		{in: "-1%", wantErr: true},
+		{in: "101%", wantErr: true},
+		{in: "ten", wantErr: true},
+		{in: "%", wantErr: true},
+		{in: "1.5", wantErr: true},
+	} {
+		got, err := ParseDeletionLimit(tc.in)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("ParseDeletionLimit(%q) = %+v, want an error", tc.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseDeletionLimit(%q) returned error %s", tc.in, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("ParseDeletionLimit(%q) = %+v, want %+v", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestDeletionLimitExceeded(t *testing.T) {
+	for _, tc := range []struct {
+		limit     string
+		deletions int
+		existing  int
+		want      bool
+	}{
+		{limit: "", deletions: 1000, existing: 10, want: false},
+		{limit: "0", deletions: 0, existing: 100, want: false},
+		{limit: "0", deletions: 1, existing: 100, want: true},
+		{limit: "5", deletions: 5, existing: 100, want: false},
+		{limit: "5", deletions: 6, existing: 100, want: true},
+		{limit: "0%", deletions: 0, existing: 100, want: false},
+		{limit: "0%", deletions: 1, existing: 100, want: true},
+		{limit: "10%", deletions: 10, existing: 100, want: false},
+		{limit: "10%", deletions: 11, existing: 100, want: true},
+		{limit: "10%", deletions: 1, existing: 9, want: true},
+		{limit: "10%", deletions: 0, existing: 0, want: false},
+		{limit: "10%", deletions: 1, existing: 0, want: true},
+		{limit: "100%", deletions: 100, existing: 100, want: false},
+	} {
+		limit, err := ParseDeletionLimit(tc.limit)
+		if err != nil {
+			t.Fatalf("ParseDeletionLimit(%q) returned error %s", tc.limit, err)
+		}
+		if got := limit.Exceeded(tc.deletions, tc.existing); got != tc.want {
+			t.Errorf("limit %q: Exceeded(%d, %d) = %v, want %v", tc.limit, tc.deletions, tc.existing, got, tc.want)
+		}
+	}
+}
+
+func TestDeletionLimitString(t *testing.T) {
+	for _, tc := range []struct {
+		limit string
+		want  string
+	}{
+		{"", "unlimited"},
+		{"0", "0"},
+		{"25", "25"},
+		{"0%", "0%"},
+		{"12.5%", "12.5%"},
+	} {
+		limit, err := ParseDeletionLimit(tc.limit)
+		if err != nil {
+			t.Fatalf("ParseDeletionLimit(%q) returned error %s", tc.limit, err)
+		}
+		if got := limit.String(); got != tc.want {
+			t.Errorf("limit %q: String() = %q, want %q", tc.limit, got, tc.want)
+		}
+	}
+}
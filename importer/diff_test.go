@@ -0,0 +1,78 @@
+package importer
+
+import "testing"
+
+func TestUnifiedDiff(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		old, new string
+		want     string
+	}{
+		{
+			name: "same",
+			old:  "a\nb\n",
+			new:  "a\nb\n",
+			want: "",
+		},
+		{
+			name: "trailing newline ignored",
+			old:  "a\nb",
+			new:  "a\nb\n",
+			want: "",
+		},
+		{
+			name: "create",
+			old:  "",
+			new:  "a\nb\n",
+			want: "--- old\n+++ new\n" +
+				"@@ -0,0 +1,2 @@\n" +
+				"+a\n+b\n",
+		},
+		{
+			name: "delete",
+			old:  "a\nb\n",
+			new:  "",
+			want: "--- old\n+++ new\n" +
+				"@@ -1,2 +0,0 @@\n" +
+				"-a\n-b\n",
+		},
+		{
+			name: "change in the middle",
+			old:  "1\n2\n3\n4\n5\n6\n7\n8\n9\n",
+			new:  "1\n2\n3\n4\nfive\n6\n7\n8\n9\n",
+			want: "--- old\n+++ new\n" +
+				"@@ -2,7 +2,7 @@\n" +
+				" 2\n 3\n 4\n-5\n+five\n 6\n 7\n 8\n",
+		},
+		{
+			name: "insertion",
+			old:  "1\n2\n3\n",
+			new:  "1\n2\nnew\n3\n",
+			want: "--- old\n+++ new\n" +
+				"@@ -1,3 +1,4 @@\n" +
+				" 1\n 2\n+new\n 3\n",
+		},
+		{
+			name: "separate hunks",
+			old:  "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n",
+			new:  "one\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\ntwelve\n",
+			want: "--- old\n+++ new\n" +
+				"@@ -1,4 +1,4 @@\n" +
+				"-1\n+one\n 2\n 3\n 4\n" +
+				"@@ -9,4 +9,4 @@\n" +
+				" 9\n 10\n 11\n-12\n+twelve\n",
+		},
+		{
+			name: "overlapping context merges hunks",
+			old:  "1\n2\n3\n4\n5\n6\n7\n8\n",
+			new:  "one\n2\n3\n4\n5\n6\n7\neight\n",
+			want: "--- old\n+++ new\n" +
+				"@@ -1,8 +1,8 @@\n" +
+				"-1\n+one\n 2\n 3\n 4\n 5\n 6\n 7\n-8\n+eight\n",
+		},
+	} {
+		if got := UnifiedDiff("old", "new", tc.old, tc.new); got != tc.want {
+			t.Errorf("%s: got diff\n%s\nwant\n%s", tc.name, got, tc.want)
+		}
+	}
+}
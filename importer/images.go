@@ -0,0 +1,330 @@
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"cgt.name/pkg/go-mwclient"
+	"github.com/antonholmquist/jason"
+	"github.com/sirupsen/logrus"
+
+	// register the DDS format, which most icons ship in.
+	_ "github.com/dperny/bta-wiki-import/importer/dds"
+)
+
+// iconArg is the template argument that names a page's icon.
+const iconArg = "|Icon="
+
+// iconExtensions are the asset formats icons are looked for in, in order of
+// preference.
+var iconExtensions = []string{".png", ".dds"}
+
+// iconImage is an icon converted to PNG, ready to upload.
+type iconImage struct {
+	icon string
+	// fileName is the name of the file on the wiki, without the namespace.
+	fileName string
+	data     []byte
+	sha1     string
+}
+
+// exportIcons returns the names of every icon referenced by a page in the
+// export, sorted.
+func exportIcons(pages []Page) []string {
+	icons := map[string]struct{}{}
+	for _, page := range pages {
+		scanner := bufio.NewScanner(strings.NewReader(page.Content))
+		for scanner.Scan() {
+			line := scanner.Text()
+			if strings.HasPrefix(line, iconArg) {
+				if icon := strings.TrimSpace(strings.TrimPrefix(line, iconArg)); icon != "" {
+					icons[icon] = struct{}{}
+				}
+			}
+		}
+	}
+
+	sorted := make([]string, 0, len(icons))
+	for icon := range icons {
+		sorted = append(sorted, icon)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
+
+// findIconAssets walks the mods directory for image files, and returns the
+// path of each, keyed by its lowercased name without extension. Where an
+// icon exists in several formats, the one earliest in iconExtensions wins.
+func findIconAssets(modsDir string) (map[string]string, error) {
+	assets := map[string]string{}
+	rank := map[string]int{}
+
+	err := filepath.Walk(modsDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if strings.HasPrefix(info.Name(), ".git") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		ext := strings.ToLower(filepath.Ext(info.Name()))
+		for i, iconExt := range iconExtensions {
+			if ext != iconExt {
+				continue
+			}
+			name := strings.ToLower(strings.TrimSuffix(info.Name(), filepath.Ext(info.Name())))
+			if r, ok := rank[name]; !ok || i < r {
+				assets[name] = path
+				rank[name] = i
+			}
+		}
+		return nil
+	})
+
+	return assets, err
+}
+
+// loadIcon reads an icon asset and converts it to PNG.
+func loadIcon(icon, path string) (iconImage, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return iconImage{}, err
+	}
+	defer file.Close()
+
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return iconImage{}, fmt.Errorf("error decoding %s: %s", path, err)
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return iconImage{}, fmt.Errorf("error converting %s to png: %s", path, err)
+	}
+
+	sum := sha1.Sum(buf.Bytes())
+	return iconImage{
+		icon:     icon,
+		fileName: normalizeTitle(icon + ".png"),
+		data:     buf.Bytes(),
+		sha1:     hex.EncodeToString(sum[:]),
+	}, nil
+}
+
+// fetchImageHashes returns the SHA-1 of the current version of each of the
+// named files, keyed by file name without namespace. Files that do not exist
+// are left out.
+func (w *client) fetchImageHashes(fileNames []string) (map[string]string, error) {
+	titles := make([]string, len(fileNames))
+	for i, fileName := range fileNames {
+		titles[i] = "File:" + fileName
+	}
+
+	hashes := map[string]string{}
+	err := w.call("getting image info", func() error {
+		resp, err := w.Get(map[string]string{
+			"action":        "query",
+			"prop":          "imageinfo",
+			"iiprop":        "sha1",
+			"titles":        strings.Join(titles, "|"),
+			"formatversion": "2",
+		})
+		if err != nil {
+			return err
+		}
+
+		pages, err := resp.GetObjectArray("query", "pages")
+		if err != nil {
+			return err
+		}
+		for _, page := range pages {
+			title, err := page.GetString("title")
+			if err != nil {
+				return err
+			}
+			var info []*jason.Object
+			if info, err = page.GetObjectArray("imageinfo"); err != nil || len(info) == 0 {
+				continue
+			}
+			if sum, err := info[0].GetString("sha1"); err == nil {
+				hashes[normalizeTitle(strings.TrimPrefix(title, "File:"))] = sum
+			}
+		}
+		return nil
+	})
+
+	return hashes, err
+}
+
+// uploadImage uploads a new version of a file. mwclient cannot send
+// multipart requests, so the upload is made directly through the run's HTTP
+// client, which shares mwclient's session.
+func (w *client) uploadImage(img iconImage) error {
+	return w.call("uploading "+img.fileName, func() error {
+		token, err := w.GetToken(mwclient.CSRFToken)
+		if err != nil {
+			return err
+		}
+
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		fields := map[string]string{
+			"action":         "upload",
+			"format":         "json",
+			"filename":       img.fileName,
+			"comment":        "automated icon update",
+			"ignorewarnings": "1",
+			"token":          token,
+		}
+		w.opts.addWriteParameters(fields, false)
+		for name, value := range fields {
+			if err := form.WriteField(name, value); err != nil {
+				return err
+			}
+		}
+		part, err := form.CreateFormFile("file", img.fileName)
+		if err != nil {
+			return err
+		}
+		if _, err := part.Write(img.data); err != nil {
+			return err
+		}
+		if err := form.Close(); err != nil {
+			return err
+		}
+
+		req, err := http.NewRequest("POST", w.opts.URL, &body)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", form.FormDataContentType())
+		req.Header.Set("User-Agent", w.UserAgent)
+
+		// httpc shares mwclient's cookies, and so the session.
+		resp, err := w.httpc.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		var result struct {
+			Upload struct {
+				Result string
+			}
+			Error *mwclient.APIError
+		}
+		respBody, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(respBody, &result); err != nil {
+			return fmt.Errorf("error parsing upload response: %s", err)
+		}
+		if result.Error != nil {
+			return *result.Error
+		}
+		if result.Upload.Result != "Success" {
+			return fmt.Errorf("upload of %s was not successful: %s", img.fileName, respBody)
+		}
+		return nil
+	})
+}
+
+// syncImages uploads every icon referenced by the export that is missing
+// from the wiki or differs from the version there, comparing by SHA-1. Icon
+// assets are looked for in the mods directory and converted to PNG. On a dry
+// run nothing is uploaded. The outcome for each file is returned.
+func (w *client) syncImages(pages []Page) ([]PageResult, error) {
+	icons := exportIcons(pages)
+	assets, err := findIconAssets(w.opts.ModsDir)
+	if err != nil {
+		return nil, err
+	}
+	logrus.Infof("export uses %d icons, found %d image assets", len(icons), len(assets))
+
+	var (
+		mu      sync.Mutex
+		results []PageResult
+	)
+	result := func(r PageResult) {
+		mu.Lock()
+		defer mu.Unlock()
+		results = append(results, r)
+	}
+
+	w.inBatches(len(icons), func(i, j int) error {
+		images := []iconImage{}
+		fileNames := []string{}
+		for _, icon := range icons[i:j] {
+			path, ok := assets[strings.ToLower(icon)]
+			if !ok {
+				logrus.Debugf("no image asset for icon %s", icon)
+				continue
+			}
+			img, err := loadIcon(icon, path)
+			if err != nil {
+				logrus.Errorf("%s", err)
+				result(PageResult{Page: "File:" + normalizeTitle(icon+".png"), Error: err.Error()})
+				continue
+			}
+			images = append(images, img)
+			fileNames = append(fileNames, img.fileName)
+		}
+		if len(images) == 0 {
+			return nil
+		}
+
+		hashes, err := w.fetchImageHashes(fileNames)
+		if err != nil {
+			for _, img := range images {
+				result(PageResult{Page: "File:" + img.fileName, Error: err.Error()})
+			}
+			return nil
+		}
+
+		for _, img := range images {
+			title := "File:" + img.fileName
+			existing, ok := hashes[img.fileName]
+			action := ActionUpdate
+			switch {
+			case !ok:
+				action = ActionCreate
+			case existing == img.sha1:
+				logrus.Debugf("UNCHANGED %s", title)
+				result(PageResult{Page: title, Action: ActionUnchanged})
+				continue
+			}
+
+			if !w.opts.DryRun {
+				if err := w.uploadImage(img); err != nil {
+					logrus.Errorf("Error uploading %s: %s", title, err)
+					result(PageResult{Page: title, Action: action, Error: err.Error()})
+					continue
+				}
+			}
+			logrus.Infof("UPLOAD %s", title)
+			result(PageResult{Page: title, Action: action, Done: !w.opts.DryRun})
+		}
+		return nil
+	})
+
+	sortResults(results)
+	return results, nil
+}
@@ -0,0 +1,96 @@
+package importer
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeIcon writes a 2x2 PNG of a single color to path, creating its
+// directory.
+func writeIcon(t *testing.T, path string, c color.Color) {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, 2, 2))
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 2; x++ {
+			img.Set(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSyncImages(t *testing.T) {
+	wiki, opts := newTestWiki(t)
+	opts.ModsDir = t.TempDir()
+	red := color.NRGBA{R: 0xff, A: 0xff}
+	writeIcon(t, filepath.Join(opts.ModsDir, "Gear", "icons", "uixIcon_laser.png"), red)
+	writeIcon(t, filepath.Join(opts.ModsDir, "Gear", "icons", "unused.png"), red)
+
+	pages := []Page{
+		rawPage("Laser", "{{Gear\n|Icon=uixIcon_laser\n}}"),
+		rawPage("Missing", "{{Gear\n|Icon=uixIcon_missing\n}}"),
+	}
+	report, err := importReport(t, pages, opts)
+	if err != nil {
+		t.Fatalf("import failed: %s", err)
+	}
+
+	if len(report.Images) != 1 {
+		t.Fatalf("got image results %+v, want only UixIcon laser.png", report.Images)
+	}
+	if result := report.Images[0]; result.Page != "File:UixIcon laser.png" || result.Action != ActionCreate || !result.Done {
+		t.Errorf("got image result %+v, want a created UixIcon laser.png", result)
+	}
+	data, ok := wiki.File("UixIcon laser.png")
+	if !ok {
+		t.Fatalf("icon was not uploaded, files are %v", wiki.Titles())
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("uploaded icon is not a png: %s", err)
+	}
+	if got := color.NRGBAModel.Convert(img.At(1, 1)); got != red {
+		t.Errorf("uploaded icon has color %v, want %v", got, red)
+	}
+	if _, ok := wiki.File("Unused.png"); ok {
+		t.Errorf("icon no page uses was uploaded")
+	}
+
+	// a second run finds the icon unchanged and uploads nothing.
+	writes := wiki.Writes()
+	report, err = importReport(t, pages, opts)
+	if err != nil {
+		t.Fatalf("second import failed: %s", err)
+	}
+	if len(report.Images) != 1 || report.Images[0].Action != ActionUnchanged {
+		t.Errorf("got image results %+v on the second run, want unchanged", report.Images)
+	}
+	if wiki.Writes() != writes {
+		t.Errorf("second run made %d writes", wiki.Writes()-writes)
+	}
+
+	// a changed icon is uploaded again.
+	blue := color.NRGBA{B: 0xff, A: 0xff}
+	writeIcon(t, filepath.Join(opts.ModsDir, "Gear", "icons", "uixIcon_laser.png"), blue)
+	report, err = importReport(t, pages, opts)
+	if err != nil {
+		t.Fatalf("third import failed: %s", err)
+	}
+	if len(report.Images) != 1 || report.Images[0].Action != ActionUpdate || !report.Images[0].Done {
+		t.Errorf("got image results %+v after changing the icon, want an update", report.Images)
+	}
+}
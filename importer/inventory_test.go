@@ -0,0 +1,66 @@
+package importer
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGetExistingPagesPaginated(t *testing.T) {
+	wiki, opts := newTestWiki(t)
+	setupExistingPages(wiki)
+	wiki.SetPage("RawData:Extra One", "one", testUser)
+	wiki.SetPage("RawData:Extra Two", "two", testUser)
+	wiki.SetAllPagesLimit(2)
+	w := loggedInClient(t, opts)
+
+	ids, err := GetExistingPages(w.Client, opts)
+	if err != nil {
+		t.Fatalf("listing pages failed: %s", err)
+	}
+	want := map[string]bool{"Changed": false, "Extra One": false, "Extra Two": false, "Same": false, "Unused": false}
+	if !reflect.DeepEqual(ids, want) {
+		t.Errorf("got pages %v, want %v", ids, want)
+	}
+
+	listings := 0
+	for _, request := range wiki.Requests() {
+		if request["list"] == "allpages" {
+			listings++
+		}
+	}
+	if listings != 3 {
+		t.Errorf("listed 5 pages in %d requests, want 3", listings)
+	}
+}
+
+func TestImportPagesIncompleteInventory(t *testing.T) {
+	wiki, opts := newTestWiki(t)
+	setupExistingPages(wiki)
+	wiki.SetPage("RawData:Extra One", "one", testUser)
+	wiki.SetPage("RawData:Extra Two", "two", testUser)
+	wiki.SetAllPagesLimit(2)
+	// the first batch is listed, and every later one fails, retries
+	// included.
+	wiki.FailAllPagesAfter(1)
+
+	report, err := importReport(t, testExport, opts)
+	if err == nil {
+		t.Errorf("import with an incomplete inventory succeeded")
+	}
+	if deleted := wiki.Deleted(); len(deleted) != 0 {
+		t.Errorf("deleted %v with an incomplete inventory", deleted)
+	}
+	for _, title := range []string{"RawData:Unused", "RawData:Extra One", "RawData:Extra Two"} {
+		if _, ok := wiki.Page(title); !ok {
+			t.Errorf("%s was deleted", title)
+		}
+	}
+
+	// creating and updating pages does not depend on the inventory.
+	if report.Created != 1 || report.Updated != 1 || report.Deleted != 0 {
+		t.Errorf("got %d created, %d updated and %d deleted, want 1, 1 and 0", report.Created, report.Updated, report.Deleted)
+	}
+	if page, _ := wiki.Page("RawData:Changed"); page.Content() != "new" {
+		t.Errorf("RawData:Changed was not updated")
+	}
+}
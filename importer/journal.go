@@ -0,0 +1,168 @@
+package importer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultJournal is the file completed page operations are recorded in.
+const DefaultJournal = "import.journal"
+
+// journalHeader is the first line of a journal, identifying the run it
+// belongs to. A journal is only resumed by a run with the same header.
+type journalHeader struct {
+	Wiki      string `json:"wiki"`
+	Namespace string `json:"namespace"`
+	// Export is the hash of every page in the export.
+	Export string `json:"export"`
+}
+
+// journalEntry records a single completed page operation.
+type journalEntry struct {
+	Page   string    `json:"page"`
+	Action Action    `json:"action"`
+	Time   time.Time `json:"time"`
+}
+
+// Journal is a local record of every page operation an import run has
+// completed, one JSON object per line, so that a run that dies part way can
+// be resumed without redoing work. A nil Journal records nothing.
+type Journal struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+	enc  *json.Encoder
+}
+
+// exportHash returns a hash of the name and content of every page in the
+// export, so that a journal can tell if the export has changed.
+func exportHash(pages []Page) string {
+	h := sha256.New()
+	for _, page := range pages {
+		fmt.Fprintf(h, "%s\x00%d\x00", page.Name(), len(page.Content))
+		h.Write([]byte(page.Content))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// readJournal returns the operations recorded in the journal at path, if its
+// header matches. ok is false if there is no journal or it belongs to a
+// different run.
+func readJournal(path string, header journalHeader) (entries []journalEntry, ok bool, err error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	defer file.Close()
+
+	d := json.NewDecoder(file)
+	var existing journalHeader
+	if err := d.Decode(&existing); err != nil {
+		return nil, false, fmt.Errorf("error parsing journal %s: %s", path, err)
+	}
+	if existing != header {
+		return nil, false, nil
+	}
+
+	for {
+		var entry journalEntry
+		err := d.Decode(&entry)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// the run most likely died part way through writing the last
+			// entry. Everything before it is still good.
+			logrus.Warnf("journal %s ends in a partial entry, ignoring it: %s", path, err)
+			break
+		}
+		entries = append(entries, entry)
+	}
+	return entries, true, nil
+}
+
+// openJournal opens the journal at path for the run identified by header. If
+// resume is set and the journal belongs to the same run, the operations it
+// already records are returned, keyed by page name, and carried over.
+// Otherwise the journal is started over.
+func openJournal(path string, header journalHeader, resume bool) (*Journal, map[string]Action, error) {
+	var entries []journalEntry
+	if resume {
+		var ok bool
+		var err error
+		entries, ok, err = readJournal(path, header)
+		if err != nil {
+			return nil, nil, err
+		}
+		if ok {
+			logrus.Infof("resuming from journal %s, %d pages already done", path, len(entries))
+		} else {
+			logrus.Warnf("journal %s is missing or is for a different export, starting from scratch", path)
+		}
+	}
+
+	// the journal is always rewritten rather than appended to, so that a
+	// partial entry left by a dead run cannot run into the next one.
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	j := &Journal{path: path, file: file, enc: json.NewEncoder(file)}
+
+	done := map[string]Action{}
+	if err := j.enc.Encode(header); err != nil {
+		file.Close()
+		return nil, nil, fmt.Errorf("error writing journal %s: %s", path, err)
+	}
+	for _, entry := range entries {
+		if err := j.enc.Encode(entry); err != nil {
+			file.Close()
+			return nil, nil, fmt.Errorf("error writing journal %s: %s", path, err)
+		}
+		done[entry.Page] = entry.Action
+	}
+	return j, done, nil
+}
+
+// Record adds a completed page operation to the journal. Failing to write
+// the journal only means the operation may be redone, so errors are logged
+// rather than returned.
+func (j *Journal) Record(page string, action Action) {
+	if j == nil {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	entry := journalEntry{Page: page, Action: action, Time: time.Now().UTC()}
+	if err := j.enc.Encode(entry); err != nil {
+		logrus.Warnf("error writing journal %s: %s", j.path, err)
+	}
+}
+
+// Close closes the journal. A journal is only needed to resume a run that did
+// not finish, so if complete is set it is removed.
+func (j *Journal) Close(complete bool) error {
+	if j == nil {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if err := j.file.Close(); err != nil {
+		return err
+	}
+	if complete {
+		return os.Remove(j.path)
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package importer
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/dperny/bta-wiki-import/importer/fakewiki"
+)
+
+// failedRun makes an import that fails part way through, on a page edited by
+// hand, and returns options for resuming it.
+func failedRun(t *testing.T, wiki *fakewiki.Server, opts Options) Options {
+	t.Helper()
+	setupExistingPages(wiki)
+	wiki.SetPage("RawData:Changed", "fixed by hand", "Someone")
+
+	opts.Journal = filepath.Join(t.TempDir(), DefaultJournal)
+	report, err := importReport(t, testExport, opts)
+	if err == nil {
+		t.Fatalf("import of a page edited by hand succeeded")
+	}
+	if report.Created != 1 || report.Deleted != 1 || report.Failed != 1 {
+		t.Fatalf("got %d created, %d deleted and %d failed, want 1 of each", report.Created, report.Deleted, report.Failed)
+	}
+	if _, err := os.Stat(opts.Journal); err != nil {
+		t.Fatalf("failed run left no journal: %s", err)
+	}
+
+	// the manual edit is dealt with, and the page the failed run created
+	// is changed behind our back, so we can tell if it is written again.
+	wiki.SetPage("RawData:Changed", "old", testUser)
+	wiki.SetPage("RawData:New", "edited since", testUser)
+	opts.Resume = true
+	return opts
+}
+
+func TestImportPagesResume(t *testing.T) {
+	wiki, opts := newTestWiki(t)
+	opts = failedRun(t, wiki, opts)
+
+	report, err := importReport(t, testExport, opts)
+	if err != nil {
+		t.Fatalf("resumed import failed: %s", err)
+	}
+	if report.Resumed != 1 || report.Created != 0 || report.Updated != 1 || report.Deleted != 0 {
+		t.Errorf(
+			"got %d resumed, %d created, %d updated and %d deleted, want 1 resumed and 1 updated",
+			report.Resumed, report.Created, report.Updated, report.Deleted,
+		)
+	}
+	if page, _ := wiki.Page("RawData:New"); page.Content() != "edited since" {
+		t.Errorf("page done by the failed run was written again, got %q", page.Content())
+	}
+	if page, _ := wiki.Page("RawData:Changed"); page.Content() != "new" {
+		t.Errorf("page that failed was not updated, got %q", page.Content())
+	}
+
+	// a run that completes has no use for its journal.
+	if _, err := os.Stat(opts.Journal); !os.IsNotExist(err) {
+		t.Errorf("complete run left its journal: %v", err)
+	}
+}
+
+func TestImportPagesResumeChangedExport(t *testing.T) {
+	wiki, opts := newTestWiki(t)
+	opts = failedRun(t, wiki, opts)
+
+	pages := append(append([]Page{}, testExport...), rawPage("Another", "another page"))
+	report, err := importReport(t, pages, opts)
+	if err != nil {
+		t.Fatalf("import failed: %s", err)
+	}
+	if report.Resumed != 0 {
+		t.Errorf("resumed %d pages from the journal of a different export", report.Resumed)
+	}
+	if page, _ := wiki.Page("RawData:New"); page.Content() != "new page" {
+		t.Errorf("page in the journal of a different export was skipped, got %q", page.Content())
+	}
+}
+
+func TestOpenJournal(t *testing.T) {
+	header := journalHeader{Wiki: "https://wiki.example/api.php", Namespace: testNamespace, Export: "abc"}
+
+	for _, tc := range []struct {
+		name   string
+		header journalHeader
+		resume bool
+		want   map[string]Action
+	}{
+		{
+			name:   "resume",
+			header: header,
+			resume: true,
+			want:   map[string]Action{"RawData:New": ActionCreate, "RawData:Unused": ActionDelete},
+		},
+		{
+			name:   "no resume",
+			header: header,
+			want:   map[string]Action{},
+		},
+		{
+			name:   "different wiki",
+			header: journalHeader{Wiki: "https://other.example/api.php", Namespace: header.Namespace, Export: header.Export},
+			resume: true,
+			want:   map[string]Action{},
+		},
+		{
+			name:   "different namespace",
+			header: journalHeader{Wiki: header.Wiki, Namespace: "Other", Export: header.Export},
+			resume: true,
+			want:   map[string]Action{},
+		},
+		{
+			name:   "different export",
+			header: journalHeader{Wiki: header.Wiki, Namespace: header.Namespace, Export: "def"},
+			resume: true,
+			want:   map[string]Action{},
+		},
+	} {
+		path := filepath.Join(t.TempDir(), DefaultJournal)
+		j, _, err := openJournal(path, header, false)
+		if err != nil {
+			t.Fatalf("%s: error opening journal: %s", tc.name, err)
+		}
+		j.Record("RawData:New", ActionCreate)
+		j.Record("RawData:Unused", ActionDelete)
+		if err := j.Close(false); err != nil {
+			t.Fatalf("%s: error closing journal: %s", tc.name, err)
+		}
+
+		j, done, err := openJournal(path, tc.header, tc.resume)
+		if err != nil {
+			t.Fatalf("%s: error reopening journal: %s", tc.name, err)
+		}
+		if !reflect.DeepEqual(done, tc.want) {
+			t.Errorf("%s: got done %v, want %v", tc.name, done, tc.want)
+		}
+		if err := j.Close(true); err != nil {
+			t.Errorf("%s: error closing journal: %s", tc.name, err)
+		}
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s: complete journal was not removed: %v", tc.name, err)
+		}
+	}
+}
@@ -2,24 +2,62 @@ package importer
 
 import (
 	"fmt"
-	"io/ioutil"
-	"os"
-	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"cgt.name/pkg/go-mwclient"
+	"github.com/antonholmquist/jason"
 	"github.com/sirupsen/logrus"
-)
 
-const URL = "https://www.bta3062.com/api.php"
+	"github.com/dperny/bta-wiki-import/export"
+)
 
 // BATCH_SIZE is the number of wiki pages to retrieve at one time.
 const BATCH_SIZE = 20
 
-func Import(wikidata string, dryrun bool, username, password string) error {
-	w, err := mwclient.New(URL, "")
+// Import imports every page in an export directory written by the export
+// command.
+func Import(wikidata string, opts Options) error {
+	opts = opts.withDefaults()
+
+	pages, err := loadExport(wikidata, opts.Namespace)
+	if err != nil {
+		return err
+	}
+	logrus.Infof("Loaded %d wiki pages", len(pages))
+
+	// the export records which mod each page came from, and the commit of
+	// the mods it was made from, for the edit summaries.
+	provenance, err := loadProvenance(wikidata)
+	if err != nil {
+		return err
+	}
+
+	return ImportPages(pages, provenance, opts)
+}
+
+// ImportPages makes the wiki match the given pages: pages that are missing or
+// different are created or updated, and pages in the import namespace that
+// are not among them are deleted. The provenance names the mod each page came
+// from, keyed by the page's Source, and may be empty.
+func ImportPages(pages []Page, provenance export.Provenance, opts Options) error {
+	started := time.Now().UTC()
+	opts = opts.withDefaults()
+	dryrun := opts.DryRun
+
+	if err := checkDuplicates(pages); err != nil {
+		return err
+	}
+	if opts.ModsCommit == "" {
+		opts.ModsCommit = provenance.Commit
+	}
+
+	w, err := newClient(opts)
 	if err != nil {
 		return err
 	}
@@ -28,249 +66,720 @@ func Import(wikidata string, dryrun bool, username, password string) error {
 		logrus.Info("doing dry run, will not make alterations")
 	}
 
-	err = w.Login(username, password)
-	if err != nil {
-		logrus.Warnf("error logging in: %s", err)
-		// if !dryrun {
-		// return fmt.Errorf("error logging in: %s", err)
-		// }
+	if err := w.startSession(); err != nil {
+		return err
+	}
+	if err := w.checkProtectLevel(); err != nil {
+		return err
 	}
 
-	ids := GetExistingPages(w)
-	logrus.Infof("existing pages: %d", len(ids))
+	// if we cannot get a complete list of the pages already on the wiki, we
+	// cannot know what is safe to delete. Still create and update pages,
+	// but skip deletions entirely.
+	ids, inventoryErr := GetExistingPages(w.Client, opts)
+	if inventoryErr != nil {
+		logrus.Errorf("error listing existing pages, will not delete anything: %s", inventoryErr)
+		ids = map[string]bool{}
+	}
+	existing := len(ids)
+	logrus.Infof("existing pages: %d", existing)
+
+	// record every page we finish, so that a run that dies part way through
+	// can pick up where it left off.
+	done := map[string]Action{}
+	if opts.Journal != "" && !dryrun {
+		header := journalHeader{Wiki: opts.URL, Namespace: opts.Namespace, Export: exportHash(pages)}
+		w.journal, done, err = openJournal(opts.Journal, header, opts.Resume)
+		if err != nil {
+			return fmt.Errorf("error opening journal: %s", err)
+		}
+	}
+	// the journal is only kept if the run did not finish cleanly.
+	complete := false
+	defer func() {
+		if err := w.journal.Close(complete); err != nil {
+			logrus.Warnf("error closing journal: %s", err)
+		}
+	}()
+
+	// every page in the export is in use. Mark them all before touching the
+	// wiki, so we know everything that would be deleted up front, and a bad
+	// export can be caught before it changes or wipes anything. Only the
+	// import namespace is cleaned up; pages in other namespaces share them
+	// with pages written by hand.
+	for _, page := range pages {
+		if normalizeTitle(page.Namespace) == normalizeTitle(opts.Namespace) {
+			ids[normalizeTitle(page.Title)] = true
+		}
+	}
 
-	wikifiles, err := ioutil.ReadDir(wikidata)
-	if err != nil {
+	candidates := []string{}
+	for id, included := range ids {
+		if included {
+			continue
+		}
+		if opts.isProtected(id) {
+			logrus.Infof("KEEP %s (allowlisted)", opts.pageName(id))
+			continue
+		}
+		candidates = append(candidates, id)
+	}
+	sort.Strings(candidates)
+
+	switch {
+	case inventoryErr != nil:
+		candidates = nil
+	case opts.NoDelete:
+		logrus.Infof("not deleting %d unused pages", len(candidates))
+		candidates = nil
+	}
+	if err := opts.checkDeletionLimit(len(candidates), existing); err != nil {
 		return err
 	}
 
-	logrus.Infof("Loading %d wiki files", len(wikifiles))
+	plan := Plan{
+		Wiki:      opts.URL,
+		Namespace: opts.Namespace,
+		Created:   time.Now().UTC(),
+	}
+	// pages the journal says are done need not even be fetched.
+	pending := []Page{}
+	for _, page := range pages {
+		if _, ok := done[page.Name()]; ok {
+			continue
+		}
+		pending = append(pending, page)
+	}
+	resumed := len(pages) - len(pending)
+	if resumed > 0 {
+		logrus.Infof("skipping %d pages already done according to the journal", resumed)
+	}
+
+	changes, unchanged, failures := w.planPages(pending, provenance)
+	deletions, deleteFailures := w.planDeletions(candidates)
+	plan.Changes = append(changes, deletions...)
+	plan.Unchanged = unchanged
+	failures = append(failures, deleteFailures...)
+	sortChanges(plan.Changes)
+
+	if opts.PlanOut != "" {
+		if err := writeJSONFile(opts.PlanOut, plan); err != nil {
+			return fmt.Errorf("error writing plan: %s", err)
+		}
+		logrus.Infof("wrote plan of %d changes to %s", len(plan.Changes), opts.PlanOut)
+	}
 
+	// planning a large import takes long enough for the session to expire.
+	if err := w.checkSession(); err != nil {
+		return fmt.Errorf("error checking session before making changes: %s", err)
+	}
+	report := w.execute(plan)
+	report.Started = started
+	report.Resumed = resumed
+	report.Failed = report.Failed + len(failures)
+	report.Pages = append(report.Pages, failures...)
+	sortResults(report.Pages)
+
+	// once the pages are in place, make sure the icons they show are too.
+	if opts.ModsDir != "" {
+		if err := w.checkSession(); err != nil {
+			return fmt.Errorf("error checking session before syncing images: %s", err)
+		}
+		images, err := w.syncImages(pages)
+		if err != nil {
+			return fmt.Errorf("error syncing images: %s", err)
+		}
+		report.Images = images
+	}
+
+	if err := w.protectReport(pages, &report); err != nil {
+		return err
+	}
+	if err := w.refreshReport(&report); err != nil {
+		return err
+	}
+	report.Finished = time.Now().UTC()
+
+	if opts.ReportOut != "" {
+		if err := writeJSONFile(opts.ReportOut, report); err != nil {
+			return fmt.Errorf("error writing report: %s", err)
+		}
+		logrus.Infof("wrote report to %s", opts.ReportOut)
+	}
+
+	if err := summarize(report); err != nil {
+		return err
+	}
+	if inventoryErr != nil {
+		return fmt.Errorf("deletions skipped, existing pages could not be listed: %s", inventoryErr)
+	}
+	complete = true
+	return nil
+}
+
+// summarize logs the outcome of an import run, and returns an error if any
+// page failed.
+func summarize(report Report) error {
+	if report.DryRun {
+		logrus.Infof(
+			"dry run, would have created %d, updated %d, deleted %d, and left %d unchanged",
+			report.Created, report.Updated, report.Deleted, report.Unchanged,
+		)
+	} else {
+		logrus.Infof(
+			"created %d, updated %d, deleted %d, and left %d unchanged",
+			report.Created, report.Updated, report.Deleted, report.Unchanged,
+		)
+	}
+
+	if report.Resumed > 0 {
+		logrus.Infof("skipped %d pages done by an earlier run", report.Resumed)
+	}
+
+	var uploaded, unchangedImages, failedImages int
+	for _, image := range report.Images {
+		switch {
+		case image.Error != "":
+			failedImages++
+		case image.Action == ActionUnchanged:
+			unchangedImages++
+		default:
+			uploaded++
+		}
+	}
+	if len(report.Images) > 0 {
+		if report.DryRun {
+			logrus.Infof("dry run, would have uploaded %d images, and left %d unchanged", uploaded, unchangedImages)
+		} else {
+			logrus.Infof("uploaded %d images, and left %d unchanged", uploaded, unchangedImages)
+		}
+	}
+
+	var refreshed, failedRefreshes int
+	for _, listing := range report.Refreshed {
+		if listing.Error != "" {
+			failedRefreshes++
+		} else {
+			refreshed++
+		}
+	}
+	if len(report.Refreshed) > 0 {
+		if report.DryRun {
+			logrus.Infof("dry run, would have refreshed %d listing pages", refreshed)
+		} else {
+			logrus.Infof("refreshed %d listing pages", refreshed)
+		}
+	}
+
+	var protected, failedProtections int
+	for _, page := range report.Protected {
+		if page.Error != "" {
+			failedProtections++
+		} else {
+			protected++
+		}
+	}
+	if len(report.Protected) > 0 {
+		if report.DryRun {
+			logrus.Infof("dry run, would have protected %d pages", protected)
+		} else {
+			logrus.Infof("protected %d pages", protected)
+		}
+	}
+	if len(report.ProtectionDrift) > 0 {
+		logrus.Warnf("%d pages had drifted from the configured protection", len(report.ProtectionDrift))
+	}
+
+	if report.Failed > 0 || failedImages > 0 || failedRefreshes > 0 || failedProtections > 0 {
+		results := append(append(append(report.Pages, report.Images...), report.Refreshed...), report.Protected...)
+		for _, result := range results {
+			if result.Error != "" {
+				logrus.Errorf("FAILED %s: %s", result.Page, result.Error)
+			}
+		}
+		return fmt.Errorf(
+			"%d pages, %d images, %d listing refreshes and %d protections failed",
+			report.Failed, failedImages, failedRefreshes, failedProtections,
+		)
+	}
+
+	return nil
+}
+
+// planPages compares every page in the export to the current version on the
+// wiki and returns the changes needed, along with the number of pages that
+// are already up to date. Pages are fetched in batches spread across the
+// workers. Pages that could not be read are returned as failed results. Each
+// change's edit summary names the mod the provenance says the page came from.
+func (w *client) planPages(pages []Page, provenance export.Provenance) ([]PlannedChange, int, []PageResult) {
 	var (
-		creations = map[string]struct{}{}
-		updates   = map[string]struct{}{}
-		unchanged = map[string]struct{}{}
+		// mu protects the values below, which are shared by every worker.
+		mu        sync.Mutex
+		changes   []PlannedChange
+		unchanged int
+		failures  []PageResult
 	)
-	doBatch := func(wikifiles []os.FileInfo) {
-		pages := []string{}
-		pageData := map[string]mwclient.BriefRevision{}
+	fail := func(pageName string, action Action, err string) {
+		mu.Lock()
+		defer mu.Unlock()
+		failures = append(failures, PageResult{Page: pageName, Action: action, Error: err})
+	}
 
-		for _, fileinfo := range wikifiles {
-			if !strings.HasSuffix(fileinfo.Name(), ".wiki") {
-				logrus.Warnf("Skipping non-wiki file %s")
-				continue
-			}
-			pageTitle := strings.TrimSuffix(fileinfo.Name(), ".wiki")
-			ids[pageTitle] = true
-			// pageName is the pageTitle with the namespace included.
-			pageName := fmt.Sprintf("RawData:%s", pageTitle)
-			pages = append(pages, pageName)
+	// do batches of pages, so we can pull down page info all at once.
+	w.inBatches(len(pages), func(i, j int) error {
+		logrus.Infof(
+			"doing batch from %s (%d) to %s (%d) (%d total)",
+			pages[i].Name(), i, pages[j-1].Name(), j, len(pages),
+		)
+
+		pageNames := []string{}
+		for _, page := range pages[i:j] {
+			pageNames = append(pageNames, page.Name())
 		}
 
-		pageData, err := w.GetPagesByName(pages...)
-		for err != nil {
-			if strings.Contains(err.Error(), "not found") {
-				break
+		pageData, err := w.fetchPages(pageNames)
+		if err != nil {
+			logrus.Errorf("Error getting pages, skipping batch: %s", err)
+			for _, pageName := range pageNames {
+				fail(pageName, "", err.Error())
 			}
-			logrus.Warnf("Error getting pages, retrying: %s", err)
-			time.Sleep(time.Second)
-			pageData, err = w.GetPagesByName(pages...)
+			return nil
 		}
 
-		for _, fileinfo := range wikifiles {
-			if !strings.HasSuffix(fileinfo.Name(), ".wiki") {
-				logrus.Warnf("Skipping non-wiki file %s")
-				continue
-			}
-			pageTitle := strings.TrimSuffix(fileinfo.Name(), ".wiki")
-			pageName := fmt.Sprintf("RawData:%s", pageTitle)
+		for _, page := range pages[i:j] {
+			pageName := page.Name()
 
 			// check if there is an old page
 			pageRev, ok := pageData[pageName]
 			if !ok {
-				logrus.Warnf("page %s not in set", pageName)
+				// a page the wiki did not return cannot be planned, but
+				// must not drop out of the report either.
+				logrus.Errorf("Error getting page %s: not in the wiki's response", pageName)
+				fail(pageName, "", "page was not in the wiki's response")
 				continue
 			}
-			content := pageRev.Content
 
-			if content != "" {
-				logrus.Debugf("Page %s already has content", pageName)
-			} else {
-				creations[pageTitle] = struct{}{}
-				logrus.Infof("CREATE %s", pageName)
+			if strings.TrimSpace(page.Content) == strings.TrimSpace(pageRev.Content) {
+				logrus.Debugf("UNCHANGED %s", pageName)
+				mu.Lock()
+				unchanged++
+				mu.Unlock()
+				continue
 			}
-			ids[pageName] = true
 
-			fileBytes, err := ioutil.ReadFile(filepath.Join(wikidata, fileinfo.Name()))
-			fileContent := string(fileBytes)
-			if err != nil {
-				logrus.Errorf("Error reading %s: %s", fileinfo.Name(), err)
-				continue
+			action := ActionUpdate
+			if pageRev.Missing {
+				action = ActionCreate
 			}
 
-			if strings.TrimSpace(fileContent) == strings.TrimSpace(content) {
-				logrus.Debugf("UNCHANGED %s", pageName)
-				unchanged[pageTitle] = struct{}{}
-			} else {
-				if content != "" {
-					logrus.Infof("UPDATE %s", pageName)
-					updates[pageTitle] = struct{}{}
-				}
-				if !dryrun {
-					if err := w.Edit(map[string]string{
-						"title":   pageName,
-						"text":    fileContent,
-						"summary": "automated page update",
-					}); err != nil {
-						logrus.Errorf("Error writing page %s to wiki: %s\n", pageName, err)
-					}
-				}
+			// never silently overwrite a fix someone made by hand.
+			if conflict := w.manualEdit(pageRev); conflict != "" {
+				logrus.Warnf("CONFLICT %s: %s", pageName, conflict)
+				fail(pageName, action, conflict)
+				continue
 			}
+
+			change := plannedChange(pageName, action, pageRev, page.Content)
+			change.Summary = w.opts.editSummary(provenance.Pages[page.Source])
+
+			mu.Lock()
+			changes = append(changes, change)
+			mu.Unlock()
 		}
-	}
+		return nil
+	})
 
-	// do batches of pages, so we can pull down page info all at once.
-	for i := 0; i < len(wikifiles); i = i + BATCH_SIZE {
-		j := i + BATCH_SIZE
-		if j > len(wikifiles) {
-			j = len(wikifiles)
+	return changes, unchanged, failures
+}
+
+// planDeletions fetches the current content of every page to be deleted, so
+// that the deletions can be recorded in the plan like any other change.
+func (w *client) planDeletions(ids []string) ([]PlannedChange, []PageResult) {
+	var (
+		mu       sync.Mutex
+		changes  []PlannedChange
+		failures []PageResult
+	)
+
+	w.inBatches(len(ids), func(i, j int) error {
+		pages := []string{}
+		for _, id := range ids[i:j] {
+			pages = append(pages, w.opts.pageName(id))
 		}
-		logrus.Infof(
-			"doing batch from %s (%d) to %s (%d) (%d total)",
-			wikifiles[i].Name(), i, wikifiles[j-1].Name(), j, len(wikifiles),
-		)
-		doBatch(wikifiles[i:j])
-	}
 
-	deletions := map[string]struct{}{}
+		pageData, err := w.fetchPages(pages)
 
-	logrus.Info("updated pages, deleting unused")
-	for id, included := range ids {
-		pageName := fmt.Sprintf("RawData:%s", id)
-		if !included {
-			token, err := w.GetToken(mwclient.CSRFToken)
+		mu.Lock()
+		defer mu.Unlock()
+		for _, pageName := range pages {
 			if err != nil {
-				logrus.Warnf("%s", err)
+				failures = append(failures, PageResult{
+					Page: pageName, Action: ActionDelete, Error: err.Error(),
+				})
 				continue
 			}
-			if !dryrun {
-				logrus.Infof("DELETE %s", pageName)
-				// delete the page
-				_, err = w.Post(map[string]string{
-					"action": "delete",
-					"reason": "updater determined page no longer in use",
-					"title":  pageName,
-					"token":  token,
+			if conflict := w.manualEdit(pageData[pageName]); conflict != "" {
+				logrus.Warnf("CONFLICT %s: %s", pageName, conflict)
+				failures = append(failures, PageResult{
+					Page: pageName, Action: ActionDelete, Error: conflict,
 				})
-				for err != nil {
-					logrus.Errorf("error deleting page %s (retrying): %s", pageName, err)
-					time.Sleep(1 * time.Second)
-					_, err = w.Post(map[string]string{
-						"action": "delete",
-						"reason": "updater determined page no longer in use",
-						"title":  pageName,
-						"token":  token,
-					})
-				}
-			} else {
-				logrus.Infof("DELETE %s", pageName)
+				continue
 			}
-			deletions[id] = struct{}{}
+			changes = append(changes, plannedChange(pageName, ActionDelete, pageData[pageName], ""))
 		}
+		return nil
+	})
+
+	return changes, failures
+}
+
+// execute makes the changes in the plan, or on a dry run only logs them, and
+// reports the outcome of each. Creations and updates are all made before any
+// deletions.
+func (w *client) execute(plan Plan) Report {
+	report := Report{
+		Wiki:      plan.Wiki,
+		DryRun:    w.opts.DryRun,
+		Unchanged: plan.Unchanged,
 	}
 
-	if dryrun {
-		logrus.Infof(
-			"dry run, would have created %d, updated %d, deleted %d, and left %d unchanged",
-			len(creations), len(updates), len(deletions), len(unchanged),
-		)
+	var (
+		mu      sync.Mutex
+		edits   []PlannedChange
+		deletes []PlannedChange
+	)
+	for _, change := range plan.Changes {
+		switch change.Action {
+		case ActionCreate, ActionUpdate:
+			edits = append(edits, change)
+		case ActionDelete:
+			deletes = append(deletes, change)
+		}
+	}
+
+	finish := func(change PlannedChange, err error) {
+		result := PageResult{Page: change.Page, Action: change.Action}
+
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			logrus.Errorf("Error applying %s to %s: %s", change.Action, change.Page, err)
+			result.Error = err.Error()
+			report.Failed++
+		} else {
+			logrus.Infof("%s %s", strings.ToUpper(string(change.Action)), change.Page)
+			result.Done = !w.opts.DryRun
+			if result.Done {
+				w.journal.Record(change.Page, change.Action)
+			}
+			switch change.Action {
+			case ActionCreate:
+				report.Created++
+			case ActionUpdate:
+				report.Updated++
+			case ActionDelete:
+				report.Deleted++
+			}
+		}
+		report.Pages = append(report.Pages, result)
+	}
+
+	parallel(w.opts.Concurrency, len(edits), func(i int) {
+		var err error
+		if !w.opts.DryRun {
+			err = w.editPage(edits[i])
+		}
+		finish(edits[i], err)
+	})
+
+	if len(deletes) > 0 {
+		logrus.Info("updated pages, deleting unused")
+	}
+	parallel(w.opts.Concurrency, len(deletes), func(i int) {
+		var err error
+		if !w.opts.DryRun {
+			err = w.deletePage(deletes[i].Page)
+		}
+		finish(deletes[i], err)
+	})
+
+	report.Finished = time.Now().UTC()
+	return report
+}
+
+// editPage makes a planned creation or update. Creations fail if the page
+// has been created since, and updates fail if the page has been deleted or
+// edited since the revision they were planned against.
+func (w *client) editPage(change PlannedChange) error {
+	// plans written before summaries were recorded have none.
+	summary := change.Summary
+	if summary == "" {
+		summary = w.opts.editSummary(export.PageSource{})
+	}
+	parameters := map[string]string{
+		"title":   change.Page,
+		"text":    change.Content,
+		"summary": summary,
+	}
+	if change.Action == ActionCreate {
+		parameters["createonly"] = "1"
 	} else {
-		logrus.Infof(
-			"created %d, updated %d, deleted %d, and left %d unchanged",
-			len(creations), len(updates), len(deletions), len(unchanged),
-		)
+		parameters["nocreate"] = "1"
+		if change.BaseTimestamp != "" {
+			parameters["basetimestamp"] = change.BaseTimestamp
+		}
 	}
+	w.opts.addWriteParameters(parameters, true)
+
+	return w.call("writing page "+change.Page, func() error {
+		// Edit keeps the token it fetched in the parameters. Drop it, so
+		// that a retry after logging in again uses the new session's.
+		delete(parameters, "token")
+		return w.Edit(parameters)
+	})
+}
 
-	return nil
+// deletePage deletes the named page.
+func (w *client) deletePage(pageName string) error {
+	return w.call("deleting page "+pageName, func() error {
+		token, err := w.GetToken(mwclient.CSRFToken)
+		if err != nil {
+			return err
+		}
+		reason := "updater determined page no longer in use"
+		if w.opts.Summary != "" {
+			reason = reason + ": " + w.opts.Summary
+		}
+		parameters := map[string]string{
+			"action": "delete",
+			"reason": reason,
+			"title":  pageName,
+			"token":  token,
+		}
+		w.opts.addWriteParameters(parameters, false)
+		_, err = w.Post(parameters)
+		return err
+	})
 }
 
-func GetExistingPages(w *mwclient.Client) map[string]bool {
-	limit := 200
-	offset := 0
+// normalizeTitle returns a page title the way the wiki stores it, with
+// spaces instead of underscores and the first letter capitalized, so that
+// titles built from file names can be compared with titles from the wiki.
+func normalizeTitle(title string) string {
+	title = strings.TrimSpace(strings.ReplaceAll(title, "_", " "))
+	r, size := utf8.DecodeRuneInString(title)
+	if r == utf8.RuneError {
+		return title
+	}
+	return string(unicode.ToUpper(r)) + title[size:]
+}
+
+// namespaceID looks up the numeric ID of the import namespace.
+func namespaceID(w *mwclient.Client, opts Options) (int64, error) {
+	namespace := opts.Namespace
+
+	var resp *jason.Object
+	err := opts.Retry.Do("looking up namespaces", func() error {
+		var err error
+		resp, err = w.Get(map[string]string{
+			"action":        "query",
+			"meta":          "siteinfo",
+			"siprop":        "namespaces",
+			"formatversion": "2",
+		})
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	namespaces, err := resp.GetObject("query", "namespaces")
+	if err != nil {
+		return 0, err
+	}
+	for _, value := range namespaces.Map() {
+		ns, err := value.Object()
+		if err != nil {
+			continue
+		}
+		name, _ := ns.GetString("name")
+		canonical, _ := ns.GetString("canonical")
+		if normalizeTitle(name) == normalizeTitle(namespace) || normalizeTitle(canonical) == normalizeTitle(namespace) {
+			return ns.GetInt64("id")
+		}
+	}
+
+	return 0, fmt.Errorf("wiki has no namespace %q", namespace)
+}
+
+// GetExistingPages returns the title, without namespace, of every page in
+// the import namespace, all mapped to false. Titles are normalized as the
+// wiki stores them. If the options ask for it, the pages are cross-checked
+// against the Cargo tables, and any differences are logged.
+//
+// If any part of the listing fails, an error is returned instead of a
+// partial set, because an incomplete inventory would skew deletions.
+func GetExistingPages(w *mwclient.Client, opts Options) (map[string]bool, error) {
+	opts = opts.withDefaults()
 
 	ids := map[string]bool{}
 
+	nsID, err := namespaceID(w, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := normalizeTitle(opts.Namespace) + ":"
+	apcontinue := ""
 	for {
 		parameters := map[string]string{
-			"action": "cargoquery",
-			"tables": "Gear",
-			"fields": "Id",
-			"format": "json",
-			"limit":  strconv.Itoa(limit),
-			"offset": strconv.Itoa(offset),
+			"action":        "query",
+			"list":          "allpages",
+			"apnamespace":   strconv.FormatInt(nsID, 10),
+			"aplimit":       "max",
+			"formatversion": "2",
+		}
+		if apcontinue != "" {
+			parameters["apcontinue"] = apcontinue
 		}
 
-		resp, err := w.Get(parameters)
+		var resp *jason.Object
+		err := opts.Retry.Do("listing existing pages", func() error {
+			var err error
+			resp, err = w.Get(parameters)
+			return err
+		})
 		if err != nil {
-			logrus.Errorf(err.Error())
+			return nil, fmt.Errorf("error listing pages after %d: %s", len(ids), err)
 		}
 
-		cargoquery, err := resp.GetObjectArray("cargoquery")
+		allpages, err := resp.GetObjectArray("query", "allpages")
 		if err != nil {
-			logrus.Errorf(err.Error())
+			return nil, fmt.Errorf("malformed page list after %d pages: %s", len(ids), err)
+		}
+		for _, page := range allpages {
+			title, err := page.GetString("title")
+			if err != nil {
+				return nil, fmt.Errorf("malformed page list after %d pages: %s", len(ids), err)
+			}
+			ids[strings.TrimPrefix(title, prefix)] = false
 		}
 
-		if len(cargoquery) == 0 {
+		// the listing is done when the wiki stops telling us where to
+		// continue from.
+		apcontinue, _ = resp.GetString("continue", "apcontinue")
+		if apcontinue == "" {
 			break
 		}
-		for _, row := range cargoquery {
-			id, err := row.GetString("title", "Id")
-			if err != nil {
-				logrus.Errorf(err.Error())
+	}
+
+	if opts.CrossCheckCargo {
+		cargoIDs, err := GetCargoPages(w, opts)
+		if err != nil {
+			logrus.Warnf("could not cross-check pages against cargo: %s", err)
+		}
+		for id := range cargoIDs {
+			if _, ok := ids[normalizeTitle(id)]; !ok {
+				logrus.Warnf("cargo lists %s, but there is no page %s%s", id, prefix, normalizeTitle(id))
 			}
-			ids[id] = false
 		}
-		offset = offset + limit
 	}
 
-	offset = 0
+	return ids, nil
+}
+
+// cargoQuery returns every row of the given fields of a Cargo table, paging
+// through the results.
+func cargoQuery(w *mwclient.Client, opts Options, table, fields string) ([]*jason.Object, error) {
+	limit := 200
+	offset := 0
+
+	rows := []*jason.Object{}
 	for {
 		parameters := map[string]string{
 			"action": "cargoquery",
-			"tables": "Chassis",
-			"fields": "VariantName,Name",
+			"tables": table,
+			"fields": fields,
 			"format": "json",
 			"limit":  strconv.Itoa(limit),
 			"offset": strconv.Itoa(offset),
 		}
 
-		resp, err := w.Get(parameters)
+		var resp *jason.Object
+		err := opts.Retry.Do("querying cargo table "+table, func() error {
+			var err error
+			resp, err = w.Get(parameters)
+			return err
+		})
 		if err != nil {
-			logrus.Errorf(err.Error())
+			return nil, fmt.Errorf("error querying %s at offset %d: %s", table, offset, err)
 		}
 
 		cargoquery, err := resp.GetObjectArray("cargoquery")
 		if err != nil {
-			logrus.Errorf(err.Error())
+			return nil, fmt.Errorf("malformed %s results at offset %d: %s", table, offset, err)
 		}
 
 		if len(cargoquery) == 0 {
 			break
 		}
-		for _, row := range cargoquery {
-			variant, err := row.GetString("title", "VariantName")
-			if err != nil {
-				logrus.Errorf(err.Error())
-			}
-			name, err := row.GetString("title", "Name")
-			if err != nil {
-				logrus.Errorf(err.Error())
-			}
+		rows = append(rows, cargoquery...)
+		offset = offset + limit
+	}
+
+	return rows, nil
+}
 
-			ids[fmt.Sprintf("MechDef_%s_%s", name, variant)] = false
+// GetCargoPages returns the titles of the pages listed in the gear, chassis
+// and vehicle Cargo tables, all mapped to false.
+func GetCargoPages(w *mwclient.Client, opts Options) (map[string]bool, error) {
+	opts = opts.withDefaults()
+
+	ids := map[string]bool{}
+
+	gear, err := cargoQuery(w, opts, opts.GearTable, "Id")
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range gear {
+		id, err := row.GetString("title", "Id")
+		if err != nil {
+			return nil, fmt.Errorf("malformed %s row: %s", opts.GearTable, err)
 		}
-		offset = offset + limit
+		ids[id] = false
+	}
+
+	chassis, err := cargoQuery(w, opts, opts.ChassisTable, "VariantName,Name")
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range chassis {
+		variant, err := row.GetString("title", "VariantName")
+		if err != nil {
+			return nil, fmt.Errorf("malformed %s row: %s", opts.ChassisTable, err)
+		}
+		name, err := row.GetString("title", "Name")
+		if err != nil {
+			return nil, fmt.Errorf("malformed %s row: %s", opts.ChassisTable, err)
+		}
+
+		ids[fmt.Sprintf("MechDef_%s_%s", name, variant)] = false
+	}
+
+	// wikis set up before vehicles were exported have no vehicle table yet,
+	// which should not stop the rest of the cross-check.
+	vehicles, err := cargoQuery(w, opts, opts.VehicleTable, "Id")
+	if err != nil {
+		logrus.Warnf("not cross-checking vehicles: %s", err)
+		return ids, nil
+	}
+	for _, row := range vehicles {
+		id, err := row.GetString("title", "Id")
+		if err != nil {
+			return nil, fmt.Errorf("malformed %s row: %s", opts.VehicleTable, err)
+		}
+		ids[id] = false
 	}
 
-	return ids
+	return ids, nil
 }
@@ -0,0 +1,322 @@
+package importer
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dperny/bta-wiki-import/export"
+	"github.com/dperny/bta-wiki-import/importer/fakewiki"
+)
+
+const (
+	testUser      = "Importer"
+	testPassword  = "hunter2"
+	testNamespace = "RawData"
+)
+
+// newTestWiki starts a fake wiki with the import namespace and a user to
+// import as, and returns it along with options for importing to it.
+func newTestWiki(t *testing.T) (*fakewiki.Server, Options) {
+	t.Helper()
+	wiki := fakewiki.New()
+	t.Cleanup(wiki.Close)
+	wiki.AddNamespace(3000, testNamespace)
+	wiki.AddUser(testUser, testPassword)
+
+	return wiki, Options{
+		URL:       wiki.APIURL(),
+		Namespace: testNamespace,
+		Username:  testUser,
+		Password:  testPassword,
+		// failures in these tests are never fixed by waiting.
+		Retry: RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond},
+	}
+}
+
+// rawPage returns a page in the import namespace.
+func rawPage(title, content string) Page {
+	return Page{Source: title, Namespace: testNamespace, Title: title, Content: content}
+}
+
+// importReport imports the pages and returns the report of the run, along
+// with the error the run returned.
+func importReport(t *testing.T, pages []Page, opts Options) (Report, error) {
+	t.Helper()
+	opts.ReportOut = filepath.Join(t.TempDir(), "report.json")
+	err := ImportPages(pages, export.Provenance{}, opts)
+	return readReport(t, opts.ReportOut, err), err
+}
+
+// readReport reads the report written by a run that returned runErr.
+func readReport(t *testing.T, path string, runErr error) Report {
+	t.Helper()
+	var report Report
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("no report written, run returned %v: %s", runErr, err)
+	}
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatalf("error reading report: %s", err)
+	}
+	return report
+}
+
+// resultActions returns the action of each page result, keyed by page.
+func resultActions(results []PageResult) map[string]Action {
+	actions := map[string]Action{}
+	for _, result := range results {
+		actions[result.Page] = result.Action
+	}
+	return actions
+}
+
+// setupExistingPages puts the pages every import test starts from on the
+// wiki, all last edited by the importer.
+func setupExistingPages(wiki *fakewiki.Server) {
+	wiki.SetPage("RawData:Same", "same", testUser)
+	wiki.SetPage("RawData:Changed", "old", testUser)
+	wiki.SetPage("RawData:Unused", "unused", testUser)
+	// pages outside the import namespace are never cleaned up.
+	wiki.SetPage("Main Page", "welcome", "Someone")
+}
+
+var testExport = []Page{
+	rawPage("Same", "same\n"),
+	rawPage("Changed", "new"),
+	rawPage("New", "new page"),
+}
+
+func TestImportPages(t *testing.T) {
+	wiki, opts := newTestWiki(t)
+	setupExistingPages(wiki)
+
+	report, err := importReport(t, testExport, opts)
+	if err != nil {
+		t.Fatalf("import failed: %s", err)
+	}
+
+	if report.Created != 1 || report.Updated != 1 || report.Deleted != 1 || report.Unchanged != 1 || report.Failed != 0 {
+		t.Errorf(
+			"got %d created, %d updated, %d deleted, %d unchanged and %d failed, want 1 of each and none failed",
+			report.Created, report.Updated, report.Deleted, report.Unchanged, report.Failed,
+		)
+	}
+	want := map[string]Action{
+		"RawData:New":     ActionCreate,
+		"RawData:Changed": ActionUpdate,
+		"RawData:Unused":  ActionDelete,
+	}
+	got := resultActions(report.Pages)
+	if len(got) != len(want) {
+		t.Errorf("got results %v, want %v", got, want)
+	}
+	for page, action := range want {
+		if got[page] != action {
+			t.Errorf("%s: got action %q, want %q", page, got[page], action)
+		}
+	}
+	for _, result := range report.Pages {
+		if !result.Done {
+			t.Errorf("%s: not done", result.Page)
+		}
+	}
+
+	for title, content := range map[string]string{
+		"RawData:New":     "new page",
+		"RawData:Changed": "new",
+		"RawData:Same":    "same",
+		"Main Page":       "welcome",
+	} {
+		page, ok := wiki.Page(title)
+		if !ok {
+			t.Errorf("%s is missing", title)
+			continue
+		}
+		if page.Content() != content {
+			t.Errorf("%s: got content %q, want %q", title, page.Content(), content)
+		}
+	}
+	if _, ok := wiki.Page("RawData:Unused"); ok {
+		t.Errorf("RawData:Unused was not deleted")
+	}
+	// an unchanged page is never written, not even with the same content.
+	if page, _ := wiki.Page("RawData:Same"); len(page.Revisions) != 1 {
+		t.Errorf("RawData:Same has %d revisions, want 1", len(page.Revisions))
+	}
+}
+
+func TestImportPagesDryRun(t *testing.T) {
+	wiki, opts := newTestWiki(t)
+	setupExistingPages(wiki)
+	titles := wiki.Titles()
+
+	opts.DryRun = true
+	opts.PlanOut = filepath.Join(t.TempDir(), "plan.json")
+	report, err := importReport(t, testExport, opts)
+	if err != nil {
+		t.Fatalf("dry run failed: %s", err)
+	}
+
+	if writes := wiki.Writes(); writes != 0 {
+		t.Errorf("dry run made %d writes", writes)
+	}
+	if got := wiki.Titles(); len(got) != len(titles) {
+		t.Errorf("dry run changed the pages on the wiki from %v to %v", titles, got)
+	}
+	if page, _ := wiki.Page("RawData:Changed"); page.Content() != "old" {
+		t.Errorf("dry run changed RawData:Changed to %q", page.Content())
+	}
+
+	// the dry run still reports what a real run would do.
+	if !report.DryRun {
+		t.Errorf("report is not marked as a dry run")
+	}
+	if report.Created != 1 || report.Updated != 1 || report.Deleted != 1 || report.Unchanged != 1 {
+		t.Errorf(
+			"got %d created, %d updated, %d deleted and %d unchanged, want 1 of each",
+			report.Created, report.Updated, report.Deleted, report.Unchanged,
+		)
+	}
+	for _, result := range report.Pages {
+		if result.Done {
+			t.Errorf("%s: marked done on a dry run", result.Page)
+		}
+	}
+
+	plan, err := LoadPlan(opts.PlanOut)
+	if err != nil {
+		t.Fatalf("error loading plan: %s", err)
+	}
+	if len(plan.Changes) != 3 || plan.Unchanged != 1 {
+		t.Errorf("plan has %d changes and %d unchanged, want 3 and 1", len(plan.Changes), plan.Unchanged)
+	}
+}
+
+func TestImportPagesManualEdit(t *testing.T) {
+	wiki, opts := newTestWiki(t)
+	setupExistingPages(wiki)
+	wiki.SetPage("RawData:Changed", "fixed by hand", "Someone")
+
+	report, err := importReport(t, testExport, opts)
+	if err == nil {
+		t.Errorf("import of a page edited by hand succeeded")
+	}
+	if report.Failed != 1 || report.Updated != 0 {
+		t.Errorf("got %d failed and %d updated, want 1 and 0", report.Failed, report.Updated)
+	}
+	if page, _ := wiki.Page("RawData:Changed"); page.Content() != "fixed by hand" {
+		t.Errorf("manual edit was overwritten with %q", page.Content())
+	}
+}
+
+func TestImportPagesNotReturned(t *testing.T) {
+	wiki, opts := newTestWiki(t)
+	setupExistingPages(wiki)
+
+	// the wiki leaves pages with invalid titles out of its response.
+	pages := append(append([]Page{}, testExport...), rawPage("Bad <Title>", "bad"))
+	report, err := importReport(t, pages, opts)
+	if err == nil {
+		t.Errorf("import with a page the wiki did not return succeeded")
+	}
+	if report.Failed != 1 || report.Created != 1 || report.Updated != 1 {
+		t.Errorf("got %d failed, %d created and %d updated, want 1 of each", report.Failed, report.Created, report.Updated)
+	}
+	var found bool
+	for _, result := range report.Pages {
+		if result.Page == "RawData:Bad <Title>" {
+			found = true
+			if result.Error == "" || result.Done {
+				t.Errorf("got result %+v, want a failure", result)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("page the wiki did not return is missing from the report")
+	}
+	if _, ok := wiki.Page("RawData:Bad <Title>"); ok {
+		t.Errorf("page with an invalid title was created")
+	}
+}
+
+func TestImportVehiclePage(t *testing.T) {
+	wiki, opts := newTestWiki(t)
+
+	chassis, err := export.ParseVehicleChassisDef(strings.NewReader(
+		`{"Description": {"Id": "vehiclechassisdef_SCHREK", "Name": "Schrek"}, "Tonnage": 80, "Locations": [{"Location": "Front", "MaxArmor": 40}]}`,
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	vehicle, err := export.ParseVehicleDef(strings.NewReader(
+		`{"Description": {"Id": "vehicledef_SCHREK"}, "ChassisID": "vehiclechassisdef_SCHREK", "Locations": [{"Location": "Front", "AssignedArmor": 40}]}`,
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := export.CompleteVehicleDef{Chassis: chassis, Vehicle: vehicle}.ToWiki()
+
+	// write the vehicle out the way the export does.
+	dir := t.TempDir()
+	source := export.EncodeTitle(vehicle.Description.Id)
+	if err := ioutil.WriteFile(filepath.Join(dir, source+".wiki"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	provenance := export.Provenance{Pages: map[string]export.PageSource{source: {Mod: "BT Advanced Vehicles"}}}
+	if err := provenance.Write(filepath.Join(dir, export.ProvenanceFile)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Import(dir, opts); err != nil {
+		t.Fatalf("import failed: %s", err)
+	}
+	page, ok := wiki.Page("RawData:vehicledef_SCHREK")
+	if !ok {
+		t.Fatalf("vehicle page was not imported, wiki has %v", wiki.Titles())
+	}
+	// trailing newlines make no difference to a wiki page.
+	if got, want := strings.TrimRight(page.Content(), "\n"), strings.TrimRight(content, "\n"); got != want {
+		t.Errorf("got content\n%s\nwant\n%s", got, want)
+	}
+	if got, want := page.Revisions[0].Summary, "automated page update from BT Advanced Vehicles"; got != want {
+		t.Errorf("got revision comment %q, want %q", got, want)
+	}
+}
+
+// TestEditConflicts checks that changes planned against one revision of a
+// page are refused by the wiki once the page has moved on.
+func TestEditConflicts(t *testing.T) {
+	wiki, opts := newTestWiki(t)
+	setupExistingPages(wiki)
+
+	w := loggedInClient(t, opts)
+	revs, err := w.fetchPages([]string{"RawData:Changed", "RawData:Created"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// someone edits and creates the pages after the plan was made.
+	wiki.SetPage("RawData:Changed", "edited since", "Someone")
+	wiki.SetPage("RawData:Created", "created since", "Someone")
+
+	for _, tc := range []struct {
+		page   string
+		action Action
+		code   string
+	}{
+		{"RawData:Changed", ActionUpdate, "editconflict"},
+		{"RawData:Created", ActionCreate, "articleexists"},
+	} {
+		err := w.editPage(plannedChange(tc.page, tc.action, revs[tc.page], "from the plan"))
+		if code := apiErrorCode(err); code != tc.code {
+			t.Errorf("%s %s: got error %v, want %s", tc.action, tc.page, err, tc.code)
+		}
+		if page, _ := wiki.Page(tc.page); page.Content() == "from the plan" {
+			t.Errorf("%s %s overwrote the page", tc.action, tc.page)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package importer
+
+import (
+	"fmt"
+)
+
+const (
+	// DefaultURL is the api.php endpoint of the BTA3062 wiki.
+	DefaultURL = "https://www.bta3062.com/api.php"
+	// DefaultNamespace is the namespace that generated pages are written to.
+	DefaultNamespace = "RawData"
+	// DefaultGearTable is the Cargo table that holds every piece of gear.
+	DefaultGearTable = "Gear"
+	// DefaultChassisTable is the Cargo table that holds every mech chassis.
+	DefaultChassisTable = "Chassis"
+	// DefaultVehicleTable is the Cargo table that holds every vehicle.
+	DefaultVehicleTable = "Vehicle"
+	// DefaultConcurrency is the number of workers talking to the wiki.
+	DefaultConcurrency = 4
+)
+
+// Options configures an import run. The zero value of each wiki-related field
+// is replaced by its default, so one binary can target several wikis by only
+// setting the fields that differ.
+type Options struct {
+	// URL is the api.php endpoint of the wiki to import to.
+	URL string
+	// Namespace is the namespace, without the trailing colon, that pages are
+	// written to.
+	Namespace string
+	// GearTable, ChassisTable and VehicleTable are the Cargo tables listing
+	// the pages that should exist on the wiki. If CrossCheckCargo is set,
+	// they are compared against the pages actually in the namespace.
+	GearTable       string
+	ChassisTable    string
+	VehicleTable    string
+	CrossCheckCargo bool
+
+	DryRun bool
+	// Username and Password log in to the wiki. Username may be a bot
+	// password's "User@botname", in which case Password is the bot password.
+	Username string
+	Password string
+	// OAuth1 and OAuth2Token, if set, authenticate every request with an
+	// OAuth owner-only consumer instead of logging in.
+	OAuth1      *OAuth1Credentials
+	OAuth2Token string
+
+	// NoDelete skips the deletion pass entirely.
+	NoDelete bool
+	// MaxDeletions aborts the run before anything is deleted if more pages
+	// would be deleted than it allows, unless Force is set.
+	MaxDeletions DeletionLimit
+	Force        bool
+	// Allowlist holds the names of pages that must never be deleted.
+	Allowlist map[string]bool
+	// OverwriteManualEdits allows changing pages whose latest revision was
+	// made by someone other than Username. Otherwise, those pages are
+	// reported as conflicts and left alone.
+	OverwriteManualEdits bool
+
+	// BotEdit and MinorEdit flag every edit as a bot edit and a minor edit,
+	// so they can be hidden from Recent Changes. BotEdit only has an effect
+	// if the user has the bot right.
+	BotEdit   bool
+	MinorEdit bool
+	// Tags are change tags applied to every edit, deletion and upload. Each
+	// must be defined on the wiki.
+	Tags []string
+	// MaxLag, if above zero, is sent with every write request, so the wiki
+	// refuses it while its replicas are lagging by more than this many
+	// seconds. Refused requests are retried once the lag has had time to
+	// clear.
+	MaxLag int
+
+	// Protect, if set, is the edit protection level, like "autoconfirmed"
+	// or "sysop", that every page in the import namespace is kept at.
+	// Pages found protected at any other level are reported as drift and
+	// set back. Unprotected pages are protected without being reported.
+	Protect string
+
+	// Retry controls how failed API calls are retried.
+	Retry RetryPolicy
+	// Concurrency is the number of pages fetched or written at once.
+	Concurrency int
+	// RequestsPerSecond limits the average rate of API requests across all
+	// workers. Zero or less is no limit.
+	RequestsPerSecond float64
+
+	// ModsDir, if set, is the mods directory the export was made from. Icon
+	// assets are found there and uploaded to the wiki after the pages.
+	ModsDir string
+
+	// Summary is a free-form message added to every edit summary.
+	Summary string
+	// ModsCommit is the git commit of the mods repository the export was
+	// made from, named in every edit summary. If empty, the commit recorded
+	// by the export is used.
+	ModsCommit string
+
+	// RefreshListings, if set, is how pages that transclude a changed page
+	// are refreshed after the import, so that their Cargo queries show the
+	// new data: RefreshPurge or RefreshNullEdit.
+	RefreshListings string
+
+	// PlanOut and ReportOut, if set, are the files that the planned changes
+	// and the outcome of the run are written to, as JSON.
+	PlanOut   string
+	ReportOut string
+
+	// Journal, if set, is the file every completed page operation is
+	// recorded in. If Resume is set, pages the journal records as done are
+	// skipped, unless the export has changed since it was written.
+	Journal string
+	Resume  bool
+}
+
+// withDefaults returns a copy of the Options with any empty settings filled
+// in.
+func (o Options) withDefaults() Options {
+	if o.URL == "" {
+		o.URL = DefaultURL
+	}
+	if o.Namespace == "" {
+		o.Namespace = DefaultNamespace
+	}
+	if o.GearTable == "" {
+		o.GearTable = DefaultGearTable
+	}
+	if o.ChassisTable == "" {
+		o.ChassisTable = DefaultChassisTable
+	}
+	if o.VehicleTable == "" {
+		o.VehicleTable = DefaultVehicleTable
+	}
+	if o.Concurrency <= 0 {
+		o.Concurrency = DefaultConcurrency
+	}
+	o.Retry = o.Retry.withDefaults()
+	return o
+}
+
+// pageName returns the full name, including namespace, of the page with the
+// given title.
+func (o Options) pageName(title string) string {
+	return fmt.Sprintf("%s:%s", o.Namespace, title)
+}
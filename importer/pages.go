@@ -0,0 +1,202 @@
+package importer
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/dperny/bta-wiki-import/export"
+)
+
+// MainNamespaceDir is the name of the export subdirectory holding pages for
+// the main namespace, which has no name of its own.
+const MainNamespaceDir = "Main"
+
+// frontMatterDelimiter starts and ends the front-matter block a page file may
+// begin with.
+const frontMatterDelimiter = "---"
+
+// Page is a single page to import, and where on the wiki it goes.
+type Page struct {
+	// Source identifies the page in the export, and is the key of its entry
+	// in the provenance. For an export directory, it is the path of the
+	// page's file, relative to the directory and without the .wiki
+	// extension.
+	Source string
+	// Namespace is the namespace the page goes in, without the colon. It is
+	// empty for the main namespace.
+	Namespace string
+	// Title is the title of the page, without the namespace.
+	Title   string
+	Content string
+}
+
+// Name returns the full name of the page, including its namespace.
+func (p Page) Name() string {
+	return namespacedName(p.Namespace, p.Title)
+}
+
+// namespacedName returns the full name of the page with the given title in the
+// given namespace.
+func namespacedName(namespace, title string) string {
+	if namespace == "" {
+		return title
+	}
+	return fmt.Sprintf("%s:%s", namespace, title)
+}
+
+// loadExport reads every page in an export directory. Files directly in the
+// directory are pages in the import namespace, as they always have been.
+// Files in a subdirectory are pages in the namespace the subdirectory is
+// named after, with MainNamespaceDir standing for the main namespace. File
+// names are page titles encoded with export.EncodeTitle.
+//
+// A file may instead say where it goes with a front-matter block, which is
+// removed from the content:
+//
+//	---
+//	namespace: Category
+//	title: Mechs/Assault
+//	---
+func loadExport(wikidata, namespace string) ([]Page, error) {
+	pages := []Page{}
+
+	files, err := ioutil.ReadDir(wikidata)
+	if err != nil {
+		return nil, err
+	}
+	for _, fileinfo := range files {
+		if !fileinfo.IsDir() {
+			page, ok, err := loadExportPage(wikidata, fileinfo.Name(), namespace)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				pages = append(pages, page)
+			}
+			continue
+		}
+
+		dirNamespace := fileinfo.Name()
+		if dirNamespace == MainNamespaceDir {
+			dirNamespace = ""
+		}
+		subfiles, err := ioutil.ReadDir(filepath.Join(wikidata, fileinfo.Name()))
+		if err != nil {
+			return nil, err
+		}
+		for _, subfile := range subfiles {
+			if subfile.IsDir() {
+				logrus.Warnf("Skipping nested directory %s", filepath.Join(fileinfo.Name(), subfile.Name()))
+				continue
+			}
+			page, ok, err := loadExportPage(wikidata, filepath.Join(fileinfo.Name(), subfile.Name()), dirNamespace)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				pages = append(pages, page)
+			}
+		}
+	}
+
+	return pages, nil
+}
+
+// checkDuplicates returns an error if two pages are the same page on the
+// wiki.
+func checkDuplicates(pages []Page) error {
+	seen := map[string]string{}
+	for _, page := range pages {
+		name := normalizeTitle(page.Name())
+		if other, ok := seen[name]; ok {
+			return fmt.Errorf("%s and %s are both the page %s", other, page.Source, page.Name())
+		}
+		seen[name] = page.Source
+	}
+	return nil
+}
+
+// loadExportPage reads the page file at path, relative to the export
+// directory, that goes in namespace unless its front-matter says otherwise.
+// ok is false for files that are not pages.
+func loadExportPage(wikidata, path, namespace string) (page Page, ok bool, err error) {
+	name := filepath.Base(path)
+	if name == export.ProvenanceFile {
+		return page, false, nil
+	}
+	if !strings.HasSuffix(name, ".wiki") {
+		logrus.Warnf("Skipping non-wiki file %s", path)
+		return page, false, nil
+	}
+
+	title, err := export.DecodeTitle(strings.TrimSuffix(name, ".wiki"))
+	if err != nil {
+		return page, false, fmt.Errorf("bad file name %s: %s", path, err)
+	}
+
+	content, err := ioutil.ReadFile(filepath.Join(wikidata, path))
+	if err != nil {
+		return page, false, err
+	}
+
+	page = Page{
+		Source:    filepath.ToSlash(strings.TrimSuffix(path, ".wiki")),
+		Namespace: namespace,
+		Title:     title,
+		Content:   string(content),
+	}
+	if err := page.parseFrontMatter(); err != nil {
+		return page, false, fmt.Errorf("bad front-matter in %s: %s", path, err)
+	}
+	return page, true, nil
+}
+
+// parseFrontMatter applies and removes the front-matter block at the start of
+// the page content, if there is one.
+func (p *Page) parseFrontMatter() error {
+	if !strings.HasPrefix(p.Content, frontMatterDelimiter+"\n") {
+		return nil
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(p.Content))
+	// skip the opening delimiter.
+	scanner.Scan()
+	consumed := len(frontMatterDelimiter) + 1
+	for scanner.Scan() {
+		line := scanner.Text()
+		consumed += len(line) + 1
+		if strings.TrimSpace(line) == frontMatterDelimiter {
+			if consumed > len(p.Content) {
+				consumed = len(p.Content)
+			}
+			p.Content = p.Content[consumed:]
+			return nil
+		}
+
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("expected key: value, got %q", line)
+		}
+		value := strings.TrimSpace(parts[1])
+		switch key := strings.TrimSpace(parts[0]); key {
+		case "namespace":
+			if value == MainNamespaceDir {
+				value = ""
+			}
+			p.Namespace = value
+		case "title":
+			p.Title = value
+		default:
+			return fmt.Errorf("unknown key %q", key)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return fmt.Errorf("no closing %s", frontMatterDelimiter)
+}
@@ -0,0 +1,129 @@
+package importer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseFrontMatter(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		content string
+		want    Page
+		err     bool
+	}{
+		{
+			name:    "none",
+			content: "{{Mech}}\n",
+			want:    Page{Namespace: "RawData", Title: "Atlas", Content: "{{Mech}}\n"},
+		},
+		{
+			name:    "namespace and title",
+			content: "---\nnamespace: Category\ntitle: Mechs/Assault\n---\n{{Mech}}\n",
+			want:    Page{Namespace: "Category", Title: "Mechs/Assault", Content: "{{Mech}}\n"},
+		},
+		{
+			name:    "main namespace",
+			content: "---\nnamespace: Main\n---\n{{Mech}}",
+			want:    Page{Title: "Atlas", Content: "{{Mech}}"},
+		},
+		{
+			name:    "spaces",
+			content: "---\n title :  Atlas II \n---  \nbody",
+			want:    Page{Namespace: "RawData", Title: "Atlas II", Content: "body"},
+		},
+		{
+			name:    "nothing after",
+			content: "---\ntitle: Atlas II\n---",
+			want:    Page{Namespace: "RawData", Title: "Atlas II", Content: ""},
+		},
+		{
+			name:    "delimiter later in the page",
+			content: "{{Mech}}\n---\ntitle: Atlas II\n---\n",
+			want:    Page{Namespace: "RawData", Title: "Atlas", Content: "{{Mech}}\n---\ntitle: Atlas II\n---\n"},
+		},
+		{
+			name:    "unknown key",
+			content: "---\nauthor: someone\n---\n",
+			err:     true,
+		},
+		{
+			name:    "not key value",
+			content: "---\ntitle\n---\n",
+			err:     true,
+		},
+		{
+			name:    "unclosed",
+			content: "---\ntitle: Atlas II\n{{Mech}}\n",
+			err:     true,
+		},
+	} {
+		page := Page{Namespace: "RawData", Title: "Atlas", Content: tc.content}
+		err := page.parseFrontMatter()
+		if tc.err {
+			if err == nil {
+				t.Errorf("%s: got no error", tc.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: got error %s", tc.name, err)
+		} else if page != tc.want {
+			t.Errorf("%s: got %+v, want %+v", tc.name, page, tc.want)
+		}
+	}
+}
+
+func TestLoadExport(t *testing.T) {
+	dir := t.TempDir()
+	for path, content := range map[string]string{
+		"Atlas.wiki":                "atlas",
+		"Mechs%2FAssault.wiki":      "assault",
+		"Template/Mech.wiki":        "template",
+		"Main/Main Page.wiki":       "welcome",
+		"Main/Moved.wiki":           "---\nnamespace: Help\ntitle: Moved Page\n---\nhelp",
+		"notes.txt":                 "not a page",
+		"Template/nested/Skip.wiki": "skipped",
+	} {
+		path = filepath.Join(dir, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pages, err := loadExport(dir, "RawData")
+	if err != nil {
+		t.Fatalf("loadExport failed: %s", err)
+	}
+	want := []Page{
+		{Source: "Atlas", Namespace: "RawData", Title: "Atlas", Content: "atlas"},
+		{Source: "Main/Main Page", Title: "Main Page", Content: "welcome"},
+		{Source: "Main/Moved", Namespace: "Help", Title: "Moved Page", Content: "help"},
+		{Source: "Mechs%2FAssault", Namespace: "RawData", Title: "Mechs/Assault", Content: "assault"},
+		{Source: "Template/Mech", Namespace: "Template", Title: "Mech", Content: "template"},
+	}
+	if !reflect.DeepEqual(pages, want) {
+		t.Errorf("got pages\n%+v\nwant\n%+v", pages, want)
+	}
+}
+
+func TestCheckDuplicates(t *testing.T) {
+	pages := []Page{
+		{Source: "Atlas", Namespace: "RawData", Title: "Atlas"},
+		{Source: "Main/Atlas", Title: "Atlas"},
+	}
+	if err := checkDuplicates(pages); err != nil {
+		t.Errorf("pages in different namespaces are duplicates: %s", err)
+	}
+
+	pages = append(pages, Page{Source: "Main/atlas", Title: "atlas"})
+	if err := checkDuplicates(pages); err == nil {
+		t.Errorf("got no error for the same page twice")
+	}
+}
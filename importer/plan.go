@@ -0,0 +1,161 @@
+package importer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"time"
+)
+
+// Action is what an import does, or would do, to a single page.
+type Action string
+
+const (
+	ActionCreate    Action = "create"
+	ActionUpdate    Action = "update"
+	ActionDelete    Action = "delete"
+	ActionUnchanged Action = "unchanged"
+)
+
+// PlannedChange is a single change an import intends to make to the wiki.
+type PlannedChange struct {
+	Page   string `json:"page"`
+	Action Action `json:"action"`
+	// OldHash and NewHash are the SHA-256 of the page content before and
+	// after the change. OldHash is empty for creations and NewHash is empty
+	// for deletions.
+	OldHash string `json:"old_hash,omitempty"`
+	NewHash string `json:"new_hash,omitempty"`
+	// BaseRevision and BaseTimestamp identify the revision the change was
+	// planned against. They are empty for creations.
+	BaseRevision  int64  `json:"base_revision,omitempty"`
+	BaseTimestamp string `json:"base_timestamp,omitempty"`
+	// Diff is a unified diff of the change.
+	Diff string `json:"diff,omitempty"`
+	// Content is the new content of the page. It is empty for deletions.
+	Content string `json:"content,omitempty"`
+	// Summary is the edit summary the change is made with.
+	Summary string `json:"summary,omitempty"`
+}
+
+// Plan is the full set of changes an import intends to make, written out so
+// it can be reviewed before a real run.
+type Plan struct {
+	Wiki      string          `json:"wiki"`
+	Namespace string          `json:"namespace"`
+	Created   time.Time       `json:"created"`
+	Unchanged int             `json:"unchanged"`
+	Changes   []PlannedChange `json:"changes"`
+}
+
+// PageResult is the outcome of a single page operation.
+type PageResult struct {
+	Page   string `json:"page"`
+	Action Action `json:"action"`
+	// Done is true if the change was actually made to the wiki. It is false
+	// for dry runs and failures.
+	Done  bool   `json:"done"`
+	Error string `json:"error,omitempty"`
+}
+
+// Report is the outcome of an import run.
+type Report struct {
+	Wiki      string    `json:"wiki"`
+	DryRun    bool      `json:"dry_run"`
+	Started   time.Time `json:"started"`
+	Finished  time.Time `json:"finished"`
+	Created   int       `json:"created"`
+	Updated   int       `json:"updated"`
+	Deleted   int       `json:"deleted"`
+	Unchanged int       `json:"unchanged"`
+	Failed    int       `json:"failed"`
+	// Resumed is the number of pages skipped because the journal of an
+	// earlier run records them as done.
+	Resumed int          `json:"resumed,omitempty"`
+	Pages   []PageResult `json:"pages"`
+	// Images holds the outcome of syncing each icon, if images were synced.
+	Images []PageResult `json:"images,omitempty"`
+	// Refreshed holds the outcome of refreshing each listing page that
+	// transcludes a changed page, if listings were refreshed.
+	Refreshed []PageResult `json:"refreshed,omitempty"`
+	// Protected holds the outcome of protecting each page that was not at
+	// the configured protection level, if pages were protected.
+	Protected []PageResult `json:"protected,omitempty"`
+	// ProtectionDrift lists the pages that existed before the run with a
+	// protection level other than the configured one. Pages that were not
+	// protected at all are not drift.
+	ProtectionDrift []ProtectionDrift `json:"protection_drift,omitempty"`
+}
+
+// contentHash returns the hex encoded SHA-256 of page content.
+func contentHash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// plannedChange describes changing the named page from its current revision
+// to newContent.
+func plannedChange(pageName string, action Action, current pageRevision, newContent string) PlannedChange {
+	oldContent := current.Content
+	change := PlannedChange{
+		Page:          pageName,
+		Action:        action,
+		BaseRevision:  current.RevID,
+		BaseTimestamp: current.Timestamp,
+		Diff:          UnifiedDiff("a/"+pageName, "b/"+pageName, oldContent, newContent),
+		Content:       newContent,
+	}
+	if action != ActionCreate {
+		change.OldHash = contentHash(oldContent)
+	}
+	if action != ActionDelete {
+		change.NewHash = contentHash(newContent)
+	}
+	return change
+}
+
+// LoadPlan reads a plan previously written by an import.
+func LoadPlan(path string) (Plan, error) {
+	var plan Plan
+
+	file, err := os.Open(path)
+	if err != nil {
+		return plan, err
+	}
+	defer file.Close()
+
+	d := json.NewDecoder(file)
+	err = d.Decode(&plan)
+	if err != nil {
+		return plan, fmt.Errorf("error parsing plan %s: %s", path, err)
+	}
+
+	return plan, nil
+}
+
+// sortChanges orders the changes by page name, so that plans are stable
+// between runs regardless of the order workers finish in.
+func sortChanges(changes []PlannedChange) {
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Page < changes[j].Page
+	})
+}
+
+func sortResults(results []PageResult) {
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Page < results[j].Page
+	})
+}
+
+// writeJSONFile writes v to path as indented JSON.
+func writeJSONFile(path string, v interface{}) error {
+	d, err := json.MarshalIndent(v, "", "\t")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(d, '\n'), 0644)
+}
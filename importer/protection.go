@@ -0,0 +1,274 @@
+package importer
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"cgt.name/pkg/go-mwclient"
+	"github.com/antonholmquist/jason"
+	"github.com/sirupsen/logrus"
+)
+
+// ActionProtect is protecting a page at the configured level.
+const ActionProtect Action = "protect"
+
+// protectionExpiry is how long the protection the importer applies lasts.
+const protectionExpiry = "infinite"
+
+// pageProtection is the protection currently on a page.
+type pageProtection struct {
+	// Levels and Expiries are keyed by the protected action, like "edit" or
+	// "move". Unprotected actions are absent.
+	Levels   map[string]string
+	Expiries map[string]string
+	// Missing is true if the page does not exist.
+	Missing bool
+}
+
+// ProtectionDrift is a page whose edit protection is not what the import is
+// configured to apply, found before the import set it back.
+type ProtectionDrift struct {
+	Page string `json:"page"`
+	// Expected and Actual are the configured and found levels.
+	Expected string `json:"expected"`
+	Actual   string `json:"actual"`
+}
+
+// fetchProtection returns the current protection of each of the named pages,
+// keyed by the names as given.
+func (w *client) fetchProtection(pageNames []string) (map[string]pageProtection, error) {
+	protections := map[string]pageProtection{}
+
+	err := w.call("getting protection of "+pageNames[0], func() error {
+		resp, err := w.Get(map[string]string{
+			"action":        "query",
+			"prop":          "info",
+			"inprop":        "protection",
+			"titles":        strings.Join(pageNames, "|"),
+			"formatversion": "2",
+		})
+		if err != nil {
+			return err
+		}
+
+		return queryPages(resp, pageNames, func(pageName string, page *jason.Object) error {
+			protection := pageProtection{
+				Levels:   map[string]string{},
+				Expiries: map[string]string{},
+			}
+			if missing, _ := page.GetBoolean("missing"); missing {
+				protection.Missing = true
+				protections[pageName] = protection
+				return nil
+			}
+			entries, _ := page.GetObjectArray("protection")
+			for _, entry := range entries {
+				// cascading protection comes from another page, and
+				// cannot be changed here.
+				if source, _ := entry.GetString("source"); source != "" {
+					continue
+				}
+				kind, _ := entry.GetString("type")
+				level, _ := entry.GetString("level")
+				expiry, _ := entry.GetString("expiry")
+				if kind != "" && level != "" {
+					protection.Levels[kind] = level
+					protection.Expiries[kind] = expiry
+				}
+			}
+			protections[pageName] = protection
+			return nil
+		})
+	})
+
+	return protections, err
+}
+
+// protectPage sets the edit protection of a page to the configured level.
+// Protection of any other action is kept as it is, because the wiki replaces
+// every protection of the page with the ones given.
+func (w *client) protectPage(pageName string, current pageProtection) error {
+	protections := []string{"edit=" + w.opts.Protect}
+	expiries := []string{protectionExpiry}
+	for kind, level := range current.Levels {
+		if kind == "edit" {
+			continue
+		}
+		protections = append(protections, kind+"="+level)
+		expiries = append(expiries, current.Expiries[kind])
+	}
+
+	return w.call("protecting page "+pageName, func() error {
+		token, err := w.GetToken(mwclient.CSRFToken)
+		if err != nil {
+			return err
+		}
+		reason := "protecting generated page"
+		if w.opts.Summary != "" {
+			reason = reason + ": " + w.opts.Summary
+		}
+		parameters := map[string]string{
+			"action":      "protect",
+			"title":       pageName,
+			"protections": strings.Join(protections, "|"),
+			"expiry":      strings.Join(expiries, "|"),
+			"reason":      reason,
+			"token":       token,
+		}
+		w.opts.addWriteParameters(parameters, false)
+		_, err = w.Post(parameters)
+		return err
+	})
+}
+
+// syncProtection makes sure every page in the import namespace carries the
+// configured edit protection. Pages that already existed but were protected
+// at another level are returned as drift; unprotected pages, and pages
+// created by this run, are protected without being reported as drift. On a dry run, nothing is protected, and pages that
+// would be created are reported as if they had been.
+func (w *client) syncProtection(pages []Page, report Report) ([]PageResult, []ProtectionDrift, error) {
+	created := map[string]bool{}
+	for _, result := range report.Pages {
+		if result.Action == ActionCreate && result.Error == "" {
+			created[result.Page] = true
+		}
+	}
+
+	names := []string{}
+	for _, page := range pages {
+		if normalizeTitle(page.Namespace) == normalizeTitle(w.opts.Namespace) {
+			names = append(names, page.Name())
+		}
+	}
+
+	var (
+		mu      sync.Mutex
+		results []PageResult
+		drift   []ProtectionDrift
+	)
+	finish := func(page string, err error) {
+		result := PageResult{Page: page, Action: ActionProtect, Done: !w.opts.DryRun}
+		if err != nil {
+			logrus.Errorf("Error protecting %s: %s", page, err)
+			result.Error = err.Error()
+			result.Done = false
+		} else {
+			logrus.Infof("PROTECT %s", page)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		results = append(results, result)
+	}
+
+	err := w.inBatches(len(names), func(i, j int) error {
+		protections, err := w.fetchProtection(names[i:j])
+		if err != nil {
+			return err
+		}
+		for _, name := range names[i:j] {
+			current, ok := protections[name]
+			if !ok {
+				continue
+			}
+			if current.Missing {
+				// a page that failed to be created has already been
+				// reported. On a dry run, pages to be created do not
+				// exist yet.
+				if w.opts.DryRun && created[name] {
+					finish(name, nil)
+				}
+				continue
+			}
+			level := current.Levels["edit"]
+			if level == w.opts.Protect {
+				continue
+			}
+			// pages that were never protected, as they all are the first
+			// time protection is turned on, have not drifted.
+			if !created[name] && level != "" {
+				logrus.Warnf("DRIFT %s is protected at %q, not %q", name, level, w.opts.Protect)
+				mu.Lock()
+				drift = append(drift, ProtectionDrift{Page: name, Expected: w.opts.Protect, Actual: level})
+				mu.Unlock()
+			}
+			if w.opts.DryRun {
+				finish(name, nil)
+				continue
+			}
+			finish(name, w.protectPage(name, current))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("error getting page protection: %s", err)
+	}
+
+	sortResults(results)
+	sortDrift(drift)
+	return results, drift, nil
+}
+
+func sortDrift(drift []ProtectionDrift) {
+	sort.Slice(drift, func(i, j int) bool {
+		return drift[i].Page < drift[j].Page
+	})
+}
+
+// protectReport applies the configured protection to the imported pages, if
+// the options ask for it, and adds the outcome to the report.
+func (w *client) protectReport(pages []Page, report *Report) error {
+	if w.opts.Protect == "" {
+		return nil
+	}
+	if err := w.checkSession(); err != nil {
+		return fmt.Errorf("error checking session before protecting pages: %s", err)
+	}
+	protected, drift, err := w.syncProtection(pages, *report)
+	if err != nil {
+		return err
+	}
+	report.Protected = protected
+	report.ProtectionDrift = drift
+	return nil
+}
+
+// protectionLevels returns the edit protection levels the wiki allows, for
+// checking the configured level before anything is changed.
+func (w *client) protectionLevels() ([]string, error) {
+	var resp *jason.Object
+	err := w.call("getting protection levels", func() error {
+		var err error
+		resp, err = w.Get(map[string]string{
+			"action":        "query",
+			"meta":          "siteinfo",
+			"siprop":        "restrictions",
+			"formatversion": "2",
+		})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp.GetStringArray("query", "restrictions", "levels")
+}
+
+// checkProtectLevel returns an error if the wiki does not know the configured
+// protection level. A wiki that does not list its levels is trusted.
+func (w *client) checkProtectLevel() error {
+	if w.opts.Protect == "" {
+		return nil
+	}
+	levels, err := w.protectionLevels()
+	if err != nil {
+		logrus.Warnf("could not list protection levels, not checking %q: %s", w.opts.Protect, err)
+		return nil
+	}
+	for _, level := range levels {
+		if level == w.opts.Protect {
+			return nil
+		}
+	}
+	return fmt.Errorf("protection level %q is not one of the wiki's: %s", w.opts.Protect, strings.Join(levels, ", "))
+}
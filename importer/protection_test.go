@@ -0,0 +1,91 @@
+package importer
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSyncProtection(t *testing.T) {
+	wiki, opts := newTestWiki(t)
+	setupExistingPages(wiki)
+	wiki.SetPage("RawData:Under score", "under", testUser)
+	wiki.SetProtection("RawData:Same", "edit", "autoconfirmed")
+	wiki.SetProtection("RawData:Same", "move", "sysop")
+	wiki.SetProtection("RawData:Changed", "edit", "sysop")
+	opts.Protect = "sysop"
+
+	pages := append(append([]Page{}, testExport...), rawPage("Under_score", "under"))
+	report, err := importReport(t, pages, opts)
+	if err != nil {
+		t.Fatalf("import failed: %s", err)
+	}
+
+	// unprotected pages and pages created by the import are not drift.
+	wantDrift := []ProtectionDrift{
+		{Page: "RawData:Same", Expected: "sysop", Actual: "autoconfirmed"},
+	}
+	if !reflect.DeepEqual(report.ProtectionDrift, wantDrift) {
+		t.Errorf("got drift %+v, want %+v", report.ProtectionDrift, wantDrift)
+	}
+	// pages the wiki knows by a normalized title are still protected.
+	wantProtected := []PageResult{
+		{Page: "RawData:New", Action: ActionProtect, Done: true},
+		{Page: "RawData:Same", Action: ActionProtect, Done: true},
+		{Page: "RawData:Under_score", Action: ActionProtect, Done: true},
+	}
+	if !reflect.DeepEqual(report.Protected, wantProtected) {
+		t.Errorf("got protected %+v, want %+v", report.Protected, wantProtected)
+	}
+
+	for title, want := range map[string]map[string]string{
+		"RawData:New":         {"edit": "sysop"},
+		"RawData:Changed":     {"edit": "sysop"},
+		"RawData:Under score": {"edit": "sysop"},
+		// protection of other actions is kept.
+		"RawData:Same": {"edit": "sysop", "move": "sysop"},
+	} {
+		page, _ := wiki.Page(title)
+		if !reflect.DeepEqual(page.Protection, want) {
+			t.Errorf("%s is protected %v, want %v", title, page.Protection, want)
+		}
+	}
+}
+
+func TestSyncProtectionDryRun(t *testing.T) {
+	wiki, opts := newTestWiki(t)
+	setupExistingPages(wiki)
+	wiki.SetProtection("RawData:Changed", "edit", "sysop")
+	opts.Protect = "sysop"
+	opts.DryRun = true
+
+	report, err := importReport(t, testExport, opts)
+	if err != nil {
+		t.Fatalf("dry run failed: %s", err)
+	}
+
+	if len(report.ProtectionDrift) != 0 {
+		t.Errorf("got drift %+v for pages that were never protected", report.ProtectionDrift)
+	}
+	wantProtected := []PageResult{
+		{Page: "RawData:New", Action: ActionProtect},
+		{Page: "RawData:Same", Action: ActionProtect},
+	}
+	if !reflect.DeepEqual(report.Protected, wantProtected) {
+		t.Errorf("got protected %+v, want %+v", report.Protected, wantProtected)
+	}
+	if page, _ := wiki.Page("RawData:Same"); len(page.Protection) != 0 {
+		t.Errorf("dry run protected RawData:Same: %v", page.Protection)
+	}
+}
+
+func TestCheckProtectLevel(t *testing.T) {
+	_, opts := newTestWiki(t)
+	opts.Protect = "sysop"
+	if err := loggedInClient(t, opts).checkProtectLevel(); err != nil {
+		t.Errorf("sysop level rejected: %s", err)
+	}
+	opts.Protect = "bureaucrat"
+	if err := loggedInClient(t, opts).checkProtectLevel(); err == nil {
+		t.Errorf("unknown level accepted")
+	}
+}
@@ -0,0 +1,176 @@
+package importer
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"cgt.name/pkg/go-mwclient"
+	"github.com/sirupsen/logrus"
+)
+
+// RateLimiter is a token bucket shared by every request of an import run. It
+// can also be paused outright when the wiki asks us to slow down.
+type RateLimiter struct {
+	mu          sync.Mutex
+	rate        float64
+	burst       float64
+	tokens      float64
+	last        time.Time
+	pausedUntil time.Time
+}
+
+// NewRateLimiter returns a limiter allowing rate requests per second on
+// average, with bursts of up to burst requests. A rate of 0 or less is no
+// limit, though the limiter can still be paused.
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimiter{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// Wait blocks until a request may be made.
+func (r *RateLimiter) Wait() {
+	for {
+		delay := r.reserve()
+		if delay <= 0 {
+			return
+		}
+		time.Sleep(delay)
+	}
+}
+
+// reserve takes a token if one is available and returns 0, or else returns
+// how long to wait before trying again.
+func (r *RateLimiter) reserve() time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	if now.Before(r.pausedUntil) {
+		return r.pausedUntil.Sub(now)
+	}
+	if r.rate <= 0 {
+		return 0
+	}
+
+	r.tokens = r.tokens + now.Sub(r.last).Seconds()*r.rate
+	if r.tokens > r.burst {
+		r.tokens = r.burst
+	}
+	r.last = now
+
+	if r.tokens >= 1 {
+		r.tokens = r.tokens - 1
+		return 0
+	}
+	return time.Duration((1 - r.tokens) / r.rate * float64(time.Second))
+}
+
+// Pause stops every request for at least the given duration.
+func (r *RateLimiter) Pause(d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if until := time.Now().Add(d); until.After(r.pausedUntil) {
+		r.pausedUntil = until
+	}
+}
+
+var lagPattern = regexp.MustCompile(`(\d+(?:\.\d+)?) seconds? lagged`)
+
+const (
+	// defaultLagDelay is how long to pause when the wiki reports replication
+	// lag without saying how much.
+	defaultLagDelay = 5 * time.Second
+	// rateLimitedDelay is how long to pause when the wiki says we have hit
+	// its rate limit for our user.
+	rateLimitedDelay = 30 * time.Second
+)
+
+// throttleTransport pauses a rate limiter whenever the wiki answers with a
+// Retry-After header, for as long as the header asks. It sees every request
+// made through the run's HTTP client, uploads included.
+type throttleTransport struct {
+	base    http.RoundTripper
+	limiter *RateLimiter
+}
+
+func (t throttleTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if delay, ok := retryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+		logrus.Warnf("wiki asked us to retry after %s, pausing requests", delay)
+		t.limiter.Pause(delay)
+	}
+	return resp, nil
+}
+
+// retryAfter parses a Retry-After header, which gives either a number of
+// seconds or the time to retry at.
+func retryAfter(header string, now time.Time) (time.Duration, bool) {
+	header = strings.TrimSpace(header)
+	if header == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(header); err == nil {
+		return time.Duration(seconds) * time.Second, seconds > 0
+	}
+	if at, err := http.ParseTime(header); err == nil {
+		return at.Sub(now), at.After(now)
+	}
+	return 0, false
+}
+
+// estimateThrottleDelay guesses how long every request should be held off,
+// if err shows the wiki asking us to slow down. The error alone does not say
+// how long the wiki wants us to wait; that is in the Retry-After header,
+// which throttleTransport honors on its own. This is the fallback for errors
+// that come without one.
+func estimateThrottleDelay(err error) (time.Duration, bool) {
+	if err == nil {
+		return 0, false
+	}
+	if errors.Is(err, mwclient.ErrAPIBusy) {
+		return defaultLagDelay, true
+	}
+
+	switch apiErrorCode(err) {
+	case "maxlag":
+		return lagDelay(err), true
+	case "ratelimited":
+		return rateLimitedDelay, true
+	case "":
+		// mwclient reports maxlag on its own error type, which it does not
+		// export, with the wiki's response as its message.
+		if lagPattern.MatchString(err.Error()) {
+			return lagDelay(err), true
+		}
+	}
+	return 0, false
+}
+
+// lagDelay waits as long as the replicas are behind, as the error reports
+// it, but never less than the five seconds MediaWiki asks for in its
+// Retry-After, or a barely lagged wiki is hit again straight away.
+func lagDelay(err error) time.Duration {
+	if m := lagPattern.FindStringSubmatch(err.Error()); m != nil {
+		if lag, perr := strconv.ParseFloat(m[1], 64); perr == nil && lag > 0 {
+			if delay := time.Duration(lag * float64(time.Second)); delay > defaultLagDelay {
+				return delay
+			}
+		}
+	}
+	return defaultLagDelay
+}
@@ -0,0 +1,133 @@
+package importer
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"cgt.name/pkg/go-mwclient"
+)
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, tc := range []struct {
+		header string
+		want   time.Duration
+		ok     bool
+	}{
+		{"", 0, false},
+		{"5", 5 * time.Second, true},
+		{" 120 ", 2 * time.Minute, true},
+		{"0", 0, false},
+		{"-3", 0, false},
+		{"Thu, 02 Jan 2020 03:04:35 GMT", 30 * time.Second, true},
+		{"Thu, 02 Jan 2020 03:00:00 GMT", 0, false},
+		{"soon", 0, false},
+	} {
+		got, ok := retryAfter(tc.header, now)
+		if ok != tc.ok || (ok && got != tc.want) {
+			t.Errorf("retryAfter(%q) = %s, %v, want %s, %v", tc.header, got, ok, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestThrottleTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("busy") != "" {
+			w.Header().Set("Retry-After", "30")
+		}
+	}))
+	defer server.Close()
+
+	limiter := NewRateLimiter(0, 1)
+	httpc := &http.Client{Transport: throttleTransport{base: http.DefaultTransport, limiter: limiter}}
+
+	resp, err := httpc.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if delay := limiter.reserve(); delay != 0 {
+		t.Errorf("limiter paused for %s without a Retry-After", delay)
+	}
+
+	resp, err = httpc.Get(server.URL + "?busy=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if delay := limiter.reserve(); delay < 29*time.Second || delay > 30*time.Second {
+		t.Errorf("limiter paused for %s after Retry-After: 30", delay)
+	}
+}
+
+func TestEstimateThrottleDelay(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		err  error
+		want time.Duration
+		ok   bool
+	}{
+		{"no error", nil, 0, false},
+		{"other error", errors.New("connection reset"), 0, false},
+		{"busy", mwclient.ErrAPIBusy, defaultLagDelay, true},
+		{"maxlag", mwclient.APIError{Code: "maxlag", Info: "Waiting for db2: 12 seconds lagged"}, 12 * time.Second, true},
+		{"maxlag below minimum", mwclient.APIError{Code: "maxlag", Info: "Waiting for db2: 1 seconds lagged"}, defaultLagDelay, true},
+		{"maxlag without lag", mwclient.APIError{Code: "maxlag", Info: "Waiting for a database server"}, defaultLagDelay, true},
+		{"maxlag body", errors.New(`{"error":{"code":"maxlag","info":"Waiting for db2: 7.5 seconds lagged"}}`), 7500 * time.Millisecond, true},
+		{"ratelimited", mwclient.APIError{Code: "ratelimited"}, rateLimitedDelay, true},
+		{"protected", mwclient.APIError{Code: "protectedpage"}, 0, false},
+	} {
+		got, ok := estimateThrottleDelay(tc.err)
+		if got != tc.want || ok != tc.ok {
+			t.Errorf("%s: got %s, %v, want %s, %v", tc.name, got, ok, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestMaxLag(t *testing.T) {
+	wiki, opts := newTestWiki(t)
+	opts.MaxLag = 5
+	opts.BotEdit = true
+	opts.Tags = []string{"data-import"}
+	// a retry would wait out the pause.
+	opts.Retry.MaxAttempts = 1
+	w := loggedInClient(t, opts)
+
+	wiki.SetLag(10)
+	// reads are never held off for lag.
+	if _, err := w.fetchPages([]string{"RawData:New"}); err != nil {
+		t.Fatalf("read while lagged failed: %s", err)
+	}
+	if delay := w.limiter.reserve(); delay != 0 {
+		t.Fatalf("read paused requests for %s", delay)
+	}
+
+	err := w.editPage(plannedChange("RawData:New", ActionCreate, pageRevision{Missing: true}, "content"))
+	if err == nil {
+		t.Fatalf("edit while lagged succeeded")
+	}
+	if _, ok := wiki.Page("RawData:New"); ok {
+		t.Errorf("page was created while lagged")
+	}
+	// the wiki reports 10 seconds of lag, which is longer than the 5 its
+	// Retry-After asks for.
+	if delay := w.limiter.reserve(); delay < 9*time.Second || delay > 10*time.Second {
+		t.Errorf("got requests paused for %s, want 10s", delay)
+	}
+
+	requests := wiki.Requests()
+	edit := requests[len(requests)-1]
+	for param, want := range map[string]string{
+		"action": "edit",
+		"maxlag": "5",
+		"bot":    "1",
+		"tags":   "data-import",
+	} {
+		if edit[param] != want {
+			t.Errorf("edit sent %s=%q, want %q", param, edit[param], want)
+		}
+	}
+}
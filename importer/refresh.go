@@ -0,0 +1,255 @@
+package importer
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"cgt.name/pkg/go-mwclient"
+	"github.com/antonholmquist/jason"
+	"github.com/sirupsen/logrus"
+)
+
+// The ways listing pages can be refreshed after an import.
+const (
+	// RefreshPurge purges each listing page with forcelinkupdate, which
+	// reparses it and reruns its Cargo queries.
+	RefreshPurge = "purge"
+	// RefreshNullEdit saves each listing page without changing it, for wikis
+	// where purging does not update Cargo data.
+	RefreshNullEdit = "null-edit"
+)
+
+const (
+	ActionPurge    Action = "purge"
+	ActionNullEdit Action = "null-edit"
+)
+
+// changedPages returns the names of the pages the report says were created,
+// updated or deleted, or would have been on a dry run.
+func changedPages(report Report) []string {
+	pages := []string{}
+	for _, result := range report.Pages {
+		if result.Error != "" {
+			continue
+		}
+		switch result.Action {
+		case ActionCreate, ActionUpdate, ActionDelete:
+			pages = append(pages, result.Page)
+		}
+	}
+	return pages
+}
+
+// transcludedIn returns the names of every page that transcludes any of the
+// given pages, other than the given pages themselves, sorted.
+func (w *client) transcludedIn(pages []string) ([]string, error) {
+	changed := map[string]bool{}
+	for _, page := range pages {
+		changed[normalizeTitle(page)] = true
+	}
+
+	var (
+		mu       sync.Mutex
+		listings = map[string]bool{}
+	)
+
+	err := w.inBatches(len(pages), func(i, j int) error {
+		found := []string{}
+		parameters := map[string]string{
+			"action":        "query",
+			"prop":          "transcludedin",
+			"titles":        strings.Join(pages[i:j], "|"),
+			"tilimit":       "max",
+			"tiprop":        "title",
+			"formatversion": "2",
+		}
+		for {
+			var resp *jason.Object
+			err := w.call("listing pages that transclude "+pages[i], func() error {
+				var err error
+				resp, err = w.Get(parameters)
+				return err
+			})
+			if err != nil {
+				return err
+			}
+
+			results, _ := resp.GetObjectArray("query", "pages")
+			for _, page := range results {
+				transclusions, _ := page.GetObjectArray("transcludedin")
+				for _, t := range transclusions {
+					if title, err := t.GetString("title"); err == nil {
+						found = append(found, title)
+					}
+				}
+			}
+
+			ticontinue, _ := resp.GetString("continue", "ticontinue")
+			if ticontinue == "" {
+				break
+			}
+			parameters["ticontinue"] = ticontinue
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		for _, title := range found {
+			if !changed[normalizeTitle(title)] {
+				listings[title] = true
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing transclusions: %s", err)
+	}
+
+	sorted := make([]string, 0, len(listings))
+	for title := range listings {
+		sorted = append(sorted, title)
+	}
+	sort.Strings(sorted)
+	return sorted, nil
+}
+
+// purgePages purges the given pages with forcelinkupdate, and returns the
+// names of the pages the wiki says it purged.
+func (w *client) purgePages(pages []string) (map[string]bool, error) {
+	purged := map[string]bool{}
+	err := w.call("purging "+pages[0], func() error {
+		parameters := map[string]string{
+			"action":          "purge",
+			"titles":          strings.Join(pages, "|"),
+			"forcelinkupdate": "1",
+			"formatversion":   "2",
+		}
+		if w.opts.MaxLag > 0 {
+			parameters["maxlag"] = strconv.Itoa(w.opts.MaxLag)
+		}
+		resp, err := w.Post(parameters)
+		if err != nil {
+			return err
+		}
+		results, err := resp.GetObjectArray("purge")
+		if err != nil {
+			return err
+		}
+		for _, result := range results {
+			title, _ := result.GetString("title")
+			if ok, _ := result.GetBoolean("purged"); ok {
+				purged[title] = true
+			}
+		}
+		return nil
+	})
+	return purged, err
+}
+
+// nullEdit saves a page without changing it, which makes the wiki reparse it
+// and store its Cargo data again.
+func (w *client) nullEdit(page string) error {
+	parameters := map[string]string{
+		"title":      page,
+		"appendtext": "",
+		"nocreate":   "1",
+	}
+	w.opts.addWriteParameters(parameters, true)
+
+	return w.call("null editing "+page, func() error {
+		// as in editPage, a retry must not reuse the old session's token.
+		delete(parameters, "token")
+		err := w.Edit(parameters)
+		if errors.Is(err, mwclient.ErrEditNoChange) {
+			// a null edit never changes anything; that is the point.
+			return nil
+		}
+		return err
+	})
+}
+
+// refreshListings purges or null edits every page that transcludes a page
+// changed by the import, so that listings built from Cargo queries show the
+// new data. On a dry run the pages are only listed. The outcome for each
+// listing page is returned.
+func (w *client) refreshListings(report Report) ([]PageResult, error) {
+	changed := changedPages(report)
+	if len(changed) == 0 {
+		return nil, nil
+	}
+
+	listings, err := w.transcludedIn(changed)
+	if err != nil {
+		return nil, err
+	}
+	logrus.Infof("%d listing pages transclude the %d changed pages", len(listings), len(changed))
+
+	action := ActionPurge
+	if w.opts.RefreshListings == RefreshNullEdit {
+		action = ActionNullEdit
+	}
+
+	var (
+		mu      sync.Mutex
+		results []PageResult
+	)
+	finish := func(page string, err error) {
+		result := PageResult{Page: page, Action: action, Done: !w.opts.DryRun}
+		if err != nil {
+			logrus.Errorf("Error refreshing %s: %s", page, err)
+			result.Error = err.Error()
+			result.Done = false
+		} else {
+			logrus.Infof("%s %s", strings.ToUpper(string(action)), page)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		results = append(results, result)
+	}
+
+	if action == ActionNullEdit || w.opts.DryRun {
+		parallel(w.opts.Concurrency, len(listings), func(i int) {
+			var err error
+			if !w.opts.DryRun {
+				err = w.nullEdit(listings[i])
+			}
+			finish(listings[i], err)
+		})
+	} else {
+		w.inBatches(len(listings), func(i, j int) error {
+			purged, err := w.purgePages(listings[i:j])
+			for _, page := range listings[i:j] {
+				if err == nil && !purged[page] {
+					finish(page, fmt.Errorf("wiki did not purge the page"))
+					continue
+				}
+				finish(page, err)
+			}
+			// failures are recorded for each page, not returned.
+			return nil
+		})
+	}
+
+	sortResults(results)
+	return results, nil
+}
+
+// refreshReport refreshes the listing pages for the changes in the report, if
+// the options ask for it, and adds the outcome to the report.
+func (w *client) refreshReport(report *Report) error {
+	if w.opts.RefreshListings == "" {
+		return nil
+	}
+	if err := w.checkSession(); err != nil {
+		return fmt.Errorf("error checking session before refreshing listings: %s", err)
+	}
+	refreshed, err := w.refreshListings(*report)
+	if err != nil {
+		return fmt.Errorf("error refreshing listing pages: %s", err)
+	}
+	report.Refreshed = refreshed
+	return nil
+}
@@ -0,0 +1,82 @@
+package importer
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/dperny/bta-wiki-import/importer/fakewiki"
+)
+
+// setupListings puts listing pages on the wiki that transclude pages in the
+// import namespace.
+func setupListings(wiki *fakewiki.Server) {
+	wiki.SetPage("Gear List", "{{RawData:Changed}}\n{{RawData:Unused}}", "Someone")
+	wiki.SetPage("Same List", "{{RawData:Same}}", "Someone")
+}
+
+func TestRefreshListingsPurge(t *testing.T) {
+	wiki, opts := newTestWiki(t)
+	setupExistingPages(wiki)
+	setupListings(wiki)
+	opts.RefreshListings = RefreshPurge
+
+	report, err := importReport(t, testExport, opts)
+	if err != nil {
+		t.Fatalf("import failed: %s", err)
+	}
+
+	// only listings of changed pages are refreshed, not those of unchanged
+	// pages.
+	if purged := wiki.Purged(); !reflect.DeepEqual(purged, []string{"Gear List"}) {
+		t.Errorf("got %v purged, want only Gear List", purged)
+	}
+	want := []PageResult{{Page: "Gear List", Action: ActionPurge, Done: true}}
+	if !reflect.DeepEqual(report.Refreshed, want) {
+		t.Errorf("got refreshed %+v, want %+v", report.Refreshed, want)
+	}
+}
+
+func TestRefreshListingsNullEdit(t *testing.T) {
+	wiki, opts := newTestWiki(t)
+	setupExistingPages(wiki)
+	setupListings(wiki)
+	opts.RefreshListings = RefreshNullEdit
+
+	report, err := importReport(t, testExport, opts)
+	if err != nil {
+		t.Fatalf("import failed: %s", err)
+	}
+
+	if purged := wiki.Purged(); len(purged) != 0 {
+		t.Errorf("got %v purged on a null edit refresh", purged)
+	}
+	want := []PageResult{{Page: "Gear List", Action: ActionNullEdit, Done: true}}
+	if !reflect.DeepEqual(report.Refreshed, want) {
+		t.Errorf("got refreshed %+v, want %+v", report.Refreshed, want)
+	}
+	// a null edit leaves no revision behind.
+	if page, _ := wiki.Page("Gear List"); len(page.Revisions) != 1 {
+		t.Errorf("Gear List has %d revisions, want 1", len(page.Revisions))
+	}
+}
+
+func TestRefreshListingsDryRun(t *testing.T) {
+	wiki, opts := newTestWiki(t)
+	setupExistingPages(wiki)
+	setupListings(wiki)
+	opts.RefreshListings = RefreshPurge
+	opts.DryRun = true
+
+	report, err := importReport(t, testExport, opts)
+	if err != nil {
+		t.Fatalf("dry run failed: %s", err)
+	}
+
+	if purged := wiki.Purged(); len(purged) != 0 {
+		t.Errorf("dry run purged %v", purged)
+	}
+	want := []PageResult{{Page: "Gear List", Action: ActionPurge}}
+	if !reflect.DeepEqual(report.Refreshed, want) {
+		t.Errorf("got refreshed %+v, want %+v", report.Refreshed, want)
+	}
+}
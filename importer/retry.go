@@ -0,0 +1,136 @@
+package importer
+
+import (
+	"errors"
+	"math/rand"
+	"time"
+
+	"cgt.name/pkg/go-mwclient"
+	"github.com/sirupsen/logrus"
+)
+
+// RetryPolicy controls how wiki API calls are retried when they fail.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of times a call is tried, including
+	// the first.
+	MaxAttempts int
+	// BaseDelay is the delay before the first retry. Each later retry waits
+	// up to twice as long as the one before it, capped at MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+// DefaultRetryPolicy is used for any RetryPolicy field left unset.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 5,
+	BaseDelay:   time.Second,
+	MaxDelay:    30 * time.Second,
+}
+
+// fatalAPIErrors are the MediaWiki error codes that will never succeed by
+// trying again.
+var fatalAPIErrors = map[string]bool{
+	"permissiondenied":    true,
+	"protectedpage":       true,
+	"protectednamespace":  true,
+	"cascadeprotected":    true,
+	"protectedtitle":      true,
+	"blocked":             true,
+	"autoblocked":         true,
+	"cantcreate":          true,
+	"cantdelete":          true,
+	"missingtitle":        true,
+	"invalidtitle":        true,
+	"badaccess-groups":    true,
+	"writeapidenied":      true,
+	"spamblacklist":       true,
+	"contenttoobig":       true,
+	"mustbeloggedin":      true,
+	"noedit":              true,
+	"noedit-anon":         true,
+	"nocreate-loggedin":   true,
+	"abusefilter-warning": true,
+	"editconflict":        true,
+	"articleexists":       true,
+	// the tags we were asked to apply are not defined on the wiki.
+	"tags-apply-not-allowed-one":   true,
+	"tags-apply-not-allowed-multi": true,
+}
+
+// apiErrorCode returns the MediaWiki error code carried by err, or the empty
+// string if err did not come from the API.
+func apiErrorCode(err error) string {
+	var apiErr mwclient.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Code
+	}
+	var apiErrPtr *mwclient.APIError
+	if errors.As(err, &apiErrPtr) && apiErrPtr != nil {
+		return apiErrPtr.Code
+	}
+	return ""
+}
+
+// IsRetryable returns true if the call that returned err might succeed if it
+// is tried again. Network failures and API errors like maxlag are retryable;
+// errors like a protected page, missing permissions or rejected credentials
+// are not.
+func IsRetryable(err error) bool {
+	if err == nil || errors.As(err, &credentialsError{}) {
+		return false
+	}
+	return !fatalAPIErrors[apiErrorCode(err)]
+}
+
+// withDefaults returns a copy of the policy with any unset fields filled in
+// from DefaultRetryPolicy.
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = DefaultRetryPolicy.MaxAttempts
+	}
+	if p.BaseDelay <= 0 {
+		p.BaseDelay = DefaultRetryPolicy.BaseDelay
+	}
+	if p.MaxDelay <= 0 {
+		p.MaxDelay = DefaultRetryPolicy.MaxDelay
+	}
+	return p
+}
+
+// backoff returns how long to wait before the given retry, counting from 1.
+// The delay is drawn uniformly from the exponential window, so that callers
+// failing at the same time do not all retry at the same time.
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	window := p.BaseDelay
+	for i := 1; i < retry && window < p.MaxDelay; i++ {
+		window = window * 2
+	}
+	if window > p.MaxDelay {
+		window = p.MaxDelay
+	}
+	return window/2 + time.Duration(rand.Int63n(int64(window/2)+1))
+}
+
+// Do calls f until it succeeds, returns an error that is not retryable, or
+// has been tried MaxAttempts times. The last error is returned. what
+// describes the call for logging.
+func (p RetryPolicy) Do(what string, f func() error) error {
+	p = p.withDefaults()
+
+	var err error
+	for attempt := 1; attempt <= p.MaxAttempts; attempt++ {
+		err = f()
+		if err == nil || !IsRetryable(err) {
+			return err
+		}
+		if attempt < p.MaxAttempts {
+			delay := p.backoff(attempt)
+			logrus.Warnf(
+				"error %s (attempt %d of %d, retrying in %s): %s",
+				what, attempt, p.MaxAttempts, delay, err,
+			)
+			time.Sleep(delay)
+		}
+	}
+	return err
+}
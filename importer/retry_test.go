@@ -0,0 +1,102 @@
+package importer
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"cgt.name/pkg/go-mwclient"
+)
+
+func TestIsRetryable(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"no error", nil, false},
+		{"network error", errors.New("connection reset by peer"), true},
+		{"maxlag", mwclient.APIError{Code: "maxlag"}, true},
+		{"session expired", mwclient.APIError{Code: "assertuserfailed"}, true},
+		{"protected", mwclient.APIError{Code: "protectedpage"}, false},
+		{"protected pointer", &mwclient.APIError{Code: "protectedpage"}, false},
+		{"wrapped protected", fmt.Errorf("editing: %w", mwclient.APIError{Code: "protectedpage"}), false},
+		{"edit conflict", mwclient.APIError{Code: "editconflict"}, false},
+		{"rejected credentials", credentialsError{mwclient.APIError{Code: "Failed"}}, false},
+		{"wrapped rejected credentials", fmt.Errorf("badtoken, and could not log in again: %w", credentialsError{errors.New("no")}), false},
+	} {
+		if got := IsRetryable(tc.err); got != tc.want {
+			t.Errorf("%s: got retryable %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestRetryPolicyDo(t *testing.T) {
+	networkErr := errors.New("connection reset by peer")
+	for _, tc := range []struct {
+		name string
+		// errs are returned by the calls in turn, and nil after.
+		errs []error
+		want error
+		// calls is the number of calls expected.
+		calls int
+	}{
+		{"success", nil, nil, 1},
+		{"retried until success", []error{networkErr, mwclient.APIError{Code: "maxlag"}}, nil, 3},
+		{"gives up after max attempts", []error{networkErr, networkErr, networkErr, networkErr, networkErr}, networkErr, 4},
+		{"fatal error", []error{mwclient.APIError{Code: "protectedpage"}, networkErr}, mwclient.APIError{Code: "protectedpage"}, 1},
+		{"fatal error after a retry", []error{networkErr, mwclient.APIError{Code: "cantcreate"}}, mwclient.APIError{Code: "cantcreate"}, 2},
+	} {
+		policy := RetryPolicy{MaxAttempts: 4, BaseDelay: time.Millisecond, MaxDelay: 2 * time.Millisecond}
+		calls := 0
+		err := policy.Do("testing", func() error {
+			calls++
+			if calls <= len(tc.errs) {
+				return tc.errs[calls-1]
+			}
+			return nil
+		})
+		if err != tc.want {
+			t.Errorf("%s: got error %v, want %v", tc.name, err, tc.want)
+		}
+		if calls != tc.calls {
+			t.Errorf("%s: got %d calls, want %d", tc.name, calls, tc.calls)
+		}
+	}
+}
+
+func TestRetryPolicyDefaults(t *testing.T) {
+	got := RetryPolicy{MaxAttempts: 2}.withDefaults()
+	want := RetryPolicy{MaxAttempts: 2, BaseDelay: DefaultRetryPolicy.BaseDelay, MaxDelay: DefaultRetryPolicy.MaxDelay}
+	if got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	if got := (RetryPolicy{}).withDefaults(); got != DefaultRetryPolicy {
+		t.Errorf("got %+v, want %+v", got, DefaultRetryPolicy)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	policy := RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	for _, tc := range []struct {
+		retry  int
+		window time.Duration
+	}{
+		{1, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond},
+		{3, 400 * time.Millisecond},
+		{4, 800 * time.Millisecond},
+		{5, time.Second},
+		{50, time.Second},
+	} {
+		// the delay is random, so draw it enough times to see the range.
+		for i := 0; i < 200; i++ {
+			delay := policy.backoff(tc.retry)
+			if delay < tc.window/2 || delay > tc.window {
+				t.Errorf("retry %d: got delay %s, want between %s and %s", tc.retry, delay, tc.window/2, tc.window)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package importer
+
+import (
+	"strings"
+
+	"github.com/antonholmquist/jason"
+	"github.com/sirupsen/logrus"
+)
+
+// pageRevision is the current revision of a page on the wiki.
+type pageRevision struct {
+	Content   string
+	Timestamp string
+	User      string
+	RevID     int64
+	// Missing is true if the page does not exist.
+	Missing bool
+}
+
+// fetchPages returns the current revision of each of the named pages, keyed
+// by the names as given. Pages that do not exist yet are returned as Missing,
+// with empty content. Pages with titles the wiki says are invalid are left
+// out.
+func (w *client) fetchPages(pageNames []string) (map[string]pageRevision, error) {
+	pageData := map[string]pageRevision{}
+
+	err := w.call("getting pages", func() error {
+		resp, err := w.Get(map[string]string{
+			"action":        "query",
+			"prop":          "revisions",
+			"titles":        strings.Join(pageNames, "|"),
+			"rvprop":        "content|timestamp|user|ids",
+			"rvslots":       "main",
+			"formatversion": "2",
+		})
+		if err != nil {
+			return err
+		}
+
+		return queryPages(resp, pageNames, func(pageName string, page *jason.Object) error {
+			if invalid, _ := page.GetBoolean("invalid"); invalid {
+				reason, _ := page.GetString("invalidreason")
+				logrus.Warnf("wiki says %s is not a valid title: %s", pageName, reason)
+				return nil
+			}
+			if missing, _ := page.GetBoolean("missing"); missing {
+				pageData[pageName] = pageRevision{Missing: true}
+				return nil
+			}
+
+			revisions, err := page.GetObjectArray("revisions")
+			if err != nil || len(revisions) == 0 {
+				pageData[pageName] = pageRevision{Missing: true}
+				return nil
+			}
+			rev := revisions[0]
+
+			content, err := rev.GetString("slots", "main", "content")
+			if err != nil {
+				// older wikis without multi-content revisions put the
+				// content on the revision itself.
+				content, _ = rev.GetString("content")
+			}
+			revID, _ := rev.GetInt64("revid")
+			user, _ := rev.GetString("user")
+			timestamp, _ := rev.GetString("timestamp")
+
+			pageData[pageName] = pageRevision{
+				Content:   content,
+				Timestamp: timestamp,
+				User:      user,
+				RevID:     revID,
+			}
+			return nil
+		})
+	})
+
+	return pageData, err
+}
+
+// queryPages calls fn for each page in the response to a query for the named
+// pages, with the name the page was asked for as. The wiki may normalize the
+// names we asked for, for example turning underscores into spaces, and gives
+// back the normalized titles.
+func queryPages(resp *jason.Object, pageNames []string, fn func(pageName string, page *jason.Object) error) error {
+	requested := map[string]string{}
+	for _, pageName := range pageNames {
+		requested[pageName] = pageName
+	}
+	if normalized, err := resp.GetObjectArray("query", "normalized"); err == nil {
+		for _, n := range normalized {
+			from, ferr := n.GetString("from")
+			to, terr := n.GetString("to")
+			if ferr == nil && terr == nil {
+				requested[to] = from
+			}
+		}
+	}
+
+	pages, err := resp.GetObjectArray("query", "pages")
+	if err != nil {
+		return err
+	}
+	for _, page := range pages {
+		title, err := page.GetString("title")
+		if err != nil {
+			return err
+		}
+		pageName, ok := requested[title]
+		if !ok {
+			pageName = title
+		}
+		if err := fn(pageName, page); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// botUser returns the name the wiki records our edits under. Bot passwords
+// log in as "User@botname", but edits are made as "User".
+func (o Options) botUser() string {
+	return strings.SplitN(o.Username, "@", 2)[0]
+}
+
+// manualEdit returns a description of the conflict if the page was last
+// edited by someone other than the importer, or the empty string if it is
+// safe to overwrite.
+func (w *client) manualEdit(rev pageRevision) string {
+	if rev.Missing || w.opts.OverwriteManualEdits {
+		return ""
+	}
+	bot := w.editUser()
+	if bot == "" || rev.User == "" || rev.User == bot {
+		return ""
+	}
+	return "last edited by " + rev.User + " at " + rev.Timestamp
+}
@@ -0,0 +1,156 @@
+package importer
+
+import (
+	"fmt"
+
+	"cgt.name/pkg/go-mwclient"
+	"github.com/sirupsen/logrus"
+)
+
+// sessionErrors are the MediaWiki error codes that mean our session has
+// expired or our token has gone stale. Logging in again fixes them.
+var sessionErrors = map[string]bool{
+	"assertuserfailed": true,
+	"assertbotfailed":  true,
+	"badtoken":         true,
+	"notloggedin":      true,
+}
+
+// credentialsError is an error logging in because the wiki rejected our
+// credentials, which trying again will not fix.
+type credentialsError struct {
+	err error
+}
+
+func (e credentialsError) Error() string {
+	return e.err.Error()
+}
+
+func (e credentialsError) Unwrap() error {
+	return e.err
+}
+
+// startSession logs in at the start of a run. Bad credentials fail the run,
+// except on a dry run, which can read the wiki without logging in.
+func (c *client) startSession() error {
+	if c.opts.DryRun && !c.opts.hasCredentials() {
+		logrus.Info("no credentials, doing dry run without logging in")
+		return nil
+	}
+
+	err := c.login()
+	if err == nil {
+		return nil
+	}
+	if !c.opts.DryRun {
+		return fmt.Errorf("error logging in: %s", err)
+	}
+	logrus.Warnf("error logging in, continuing dry run without logging in: %s", err)
+	return nil
+}
+
+// login logs in with the configured credentials. With OAuth there is no
+// session to log in to, but the credentials are still checked.
+func (c *client) login() error {
+	c.session.Lock()
+	defer c.session.Unlock()
+	return c.loginLocked()
+}
+
+// loginLocked logs in, and has every request after assert that we are still
+// logged in, so that an expired session fails the request instead of
+// silently reading or writing as an anonymous user. It must be called with
+// the session lock held.
+func (c *client) loginLocked() error {
+	// the login requests themselves must not assert we are logged in, and
+	// any tokens from the old session are no longer any good.
+	c.Assert = mwclient.AssertNone
+	c.Tokens = map[string]string{}
+
+	if !c.opts.usesOAuth() {
+		if err := c.Login(c.opts.Username, c.opts.Password); err != nil {
+			// the wiki answers a bad username or password with the
+			// login result as the error code.
+			if apiErrorCode(err) != "" {
+				return credentialsError{err}
+			}
+			return err
+		}
+	}
+	c.Assert = mwclient.AssertUser
+
+	// ask the wiki who we are. This catches OAuth credentials that do not
+	// work, and tells us the name our edits are made under.
+	resp, err := c.Get(map[string]string{
+		"action":        "query",
+		"meta":          "userinfo",
+		"formatversion": "2",
+	})
+	if err != nil {
+		return err
+	}
+	if anon, _ := resp.GetBoolean("query", "userinfo", "anon"); anon {
+		return credentialsError{fmt.Errorf("wiki did not accept our credentials")}
+	}
+	if c.user, err = resp.GetString("query", "userinfo", "name"); err != nil {
+		return fmt.Errorf("malformed user info: %s", err)
+	}
+	logrus.Infof("logged in as %s", c.user)
+
+	c.loggedIn = true
+	c.generation++
+
+	// fetch the CSRF token now, while no worker is using the client, so
+	// that every write after shares it instead of fetching its own.
+	_, err = c.GetToken(mwclient.CSRFToken)
+	return err
+}
+
+// editUser returns the name the wiki records our edits under.
+func (c *client) editUser() string {
+	c.session.RLock()
+	defer c.session.RUnlock()
+	if c.user != "" {
+		return c.user
+	}
+	return c.opts.botUser()
+}
+
+// relogin logs in again after a request made in the given session generation
+// failed with a session error. If another worker has already logged in again
+// since, relogin does nothing.
+func (c *client) relogin(generation int) error {
+	c.session.Lock()
+	defer c.session.Unlock()
+	if c.generation != generation {
+		return nil
+	}
+	logrus.Info("logging in again")
+	return c.loginLocked()
+}
+
+// checkSession makes sure we are still logged in, logging in again if not.
+// It is called between the phases of a run, which can each take a long time.
+func (c *client) checkSession() error {
+	c.session.RLock()
+	loggedIn := c.loggedIn
+	c.session.RUnlock()
+	if !loggedIn {
+		return nil
+	}
+
+	return c.call("checking session", func() error {
+		resp, err := c.Get(map[string]string{
+			"action":        "query",
+			"meta":          "userinfo",
+			"formatversion": "2",
+		})
+		if err != nil {
+			return err
+		}
+		if anon, _ := resp.GetBoolean("query", "userinfo", "anon"); anon {
+			return mwclient.APIError{Code: "assertuserfailed", Info: "session is no longer logged in"}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,114 @@
+package importer
+
+import (
+	"testing"
+
+	"github.com/dperny/bta-wiki-import/importer/fakewiki"
+)
+
+// loggedInClient returns a client for the options that has started its
+// session.
+func loggedInClient(t *testing.T, opts Options) *client {
+	t.Helper()
+	w, err := newClient(opts.withDefaults())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.startSession(); err != nil {
+		t.Fatal(err)
+	}
+	return w
+}
+
+// logins counts the login requests the wiki has seen.
+func logins(wiki *fakewiki.Server) int {
+	count := 0
+	for _, request := range wiki.Requests() {
+		if request["action"] == "login" {
+			count++
+		}
+	}
+	return count
+}
+
+func TestReloginAfterSessionExpires(t *testing.T) {
+	wiki, opts := newTestWiki(t)
+	w := loggedInClient(t, opts)
+	if n := logins(wiki); n != 1 {
+		t.Fatalf("got %d logins to start the session, want 1", n)
+	}
+
+	wiki.ExpireSessions()
+	err := w.editPage(plannedChange("RawData:New", ActionCreate, pageRevision{Missing: true}, "content"))
+	if err != nil {
+		t.Fatalf("edit after the session expired failed: %s", err)
+	}
+	if n := logins(wiki); n != 2 {
+		t.Errorf("got %d logins, want 2", n)
+	}
+	page, ok := wiki.Page("RawData:New")
+	if !ok {
+		t.Fatalf("page was not created")
+	}
+	// the edit must not have been made anonymously.
+	if user := page.Revisions[0].User; user != testUser {
+		t.Errorf("page was created by %q, not %q", user, testUser)
+	}
+
+	// checking the session between phases notices it expired, too.
+	wiki.ExpireSessions()
+	if err := w.checkSession(); err != nil {
+		t.Fatalf("checking the session failed: %s", err)
+	}
+	if n := logins(wiki); n != 3 {
+		t.Errorf("got %d logins, want 3", n)
+	}
+}
+
+func TestStartSessionBadCredentials(t *testing.T) {
+	_, opts := newTestWiki(t)
+	opts.Password = "wrong"
+
+	w, err := newClient(opts.withDefaults())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.startSession(); err == nil {
+		t.Errorf("logging in with the wrong password succeeded")
+	}
+
+	// a dry run carries on without logging in.
+	opts.DryRun = true
+	w, err = newClient(opts.withDefaults())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.startSession(); err != nil {
+		t.Errorf("dry run with the wrong password failed: %s", err)
+	}
+}
+
+func TestReloginBadCredentials(t *testing.T) {
+	wiki, opts := newTestWiki(t)
+	opts.Retry.MaxAttempts = 3
+	w := loggedInClient(t, opts)
+
+	// the password changed while the import was running.
+	wiki.AddUser(testUser, "changed")
+	wiki.ExpireSessions()
+	err := w.editPage(plannedChange("RawData:New", ActionCreate, pageRevision{Missing: true}, "content"))
+	if err == nil {
+		t.Fatalf("edit succeeded without logging in again")
+	}
+	if IsRetryable(err) {
+		t.Errorf("failing to log in again is retryable: %s", err)
+	}
+	// the first login, and one failed attempt to log in again, without any
+	// retries.
+	if n := logins(wiki); n != 2 {
+		t.Errorf("got %d logins, want 2", n)
+	}
+	if _, ok := wiki.Page("RawData:New"); ok {
+		t.Errorf("page was created without logging in")
+	}
+}
@@ -0,0 +1,67 @@
+package importer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/dperny/bta-wiki-import/export"
+)
+
+// defaultSummary is the edit summary used when nothing more is known about
+// where a page came from.
+const defaultSummary = "automated page update"
+
+// maxSummaryLength is the longest edit summary, in characters, that MediaWiki
+// keeps. Longer summaries are cut off by the wiki.
+const maxSummaryLength = 500
+
+// loadProvenance reads the provenance file from an export directory. Exports
+// made before provenance was recorded have none, in which case an empty
+// Provenance is returned.
+func loadProvenance(wikidata string) (export.Provenance, error) {
+	path := filepath.Join(wikidata, export.ProvenanceFile)
+	provenance, err := export.LoadProvenance(path)
+	if os.IsNotExist(err) {
+		logrus.Warnf("export has no %s, edit summaries will not name mods", export.ProvenanceFile)
+		return export.Provenance{}, nil
+	}
+	if err != nil {
+		return provenance, fmt.Errorf("error reading %s: %s", path, err)
+	}
+	return provenance, nil
+}
+
+// editSummary builds the summary for an edit to a page defined by the given
+// mod, like "automated page update from BT Advanced Core 1.2.3 with merges
+// from BTA Lasers (mods 0123456789ab): rebalance lasers". Any part that is not
+// known is left out. Summaries too long for the wiki are cut short, ending
+// in "...".
+func (o Options) editSummary(source export.PageSource) string {
+	summary := defaultSummary
+	if source.Mod != "" {
+		summary = summary + " from " + source.Mod
+		if source.Version != "" {
+			summary = summary + " " + source.Version
+		}
+	}
+	if len(source.Merged) > 0 {
+		summary = summary + " with merges from " + strings.Join(source.Merged, ", ")
+	}
+	if commit := o.ModsCommit; commit != "" {
+		if len(commit) > 12 {
+			commit = commit[:12]
+		}
+		summary = fmt.Sprintf("%s (mods %s)", summary, commit)
+	}
+	if o.Summary != "" {
+		summary = summary + ": " + o.Summary
+	}
+	if runes := []rune(summary); len(runes) > maxSummaryLength {
+		summary = string(runes[:maxSummaryLength-3]) + "..."
+	}
+	return summary
+}
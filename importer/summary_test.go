@@ -0,0 +1,135 @@
+package importer
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dperny/bta-wiki-import/export"
+)
+
+func TestEditSummary(t *testing.T) {
+	long := strings.Repeat("é", maxSummaryLength)
+
+	for _, tc := range []struct {
+		name   string
+		opts   Options
+		source export.PageSource
+		want   string
+	}{
+		{
+			name: "no provenance",
+			want: "automated page update",
+		},
+		{
+			name:   "single mod",
+			source: export.PageSource{Mod: "BT Advanced Core", Version: "1.2.3"},
+			want:   "automated page update from BT Advanced Core 1.2.3",
+		},
+		{
+			name:   "mod without a version",
+			source: export.PageSource{Mod: "BT Advanced Core"},
+			want:   "automated page update from BT Advanced Core",
+		},
+		{
+			name:   "merges",
+			source: export.PageSource{Mod: "BT Advanced Core", Merged: []string{"BTA Lasers", "BTA Balance"}},
+			want:   "automated page update from BT Advanced Core with merges from BTA Lasers, BTA Balance",
+		},
+		{
+			name: "commit and summary",
+			opts: Options{ModsCommit: "0123456789abcdef0123456789abcdef01234567", Summary: "rebalance lasers"},
+			source: export.PageSource{
+				Mod:     "BT Advanced Core",
+				Version: "1.2.3",
+				Merged:  []string{"BTA Lasers"},
+			},
+			want: "automated page update from BT Advanced Core 1.2.3 with merges from BTA Lasers (mods 0123456789ab): rebalance lasers",
+		},
+		{
+			name: "short commit",
+			opts: Options{ModsCommit: "0123abc"},
+			want: "automated page update (mods 0123abc)",
+		},
+		{
+			name: "too long",
+			opts: Options{Summary: long},
+			want: "automated page update: " + long[:len("é")*(maxSummaryLength-len("automated page update: ")-3)] + "...",
+		},
+	} {
+		got := tc.opts.editSummary(tc.source)
+		if got != tc.want {
+			t.Errorf("%s: got summary %q, want %q", tc.name, got, tc.want)
+		}
+		if n := len([]rune(got)); n > maxSummaryLength {
+			t.Errorf("%s: got a summary of %d characters, want at most %d", tc.name, n, maxSummaryLength)
+		}
+	}
+}
+
+func TestLoadProvenance(t *testing.T) {
+	dir := t.TempDir()
+	provenance, err := loadProvenance(dir)
+	if err != nil {
+		t.Errorf("export without provenance: got error %s", err)
+	}
+	if !reflect.DeepEqual(provenance, export.Provenance{}) {
+		t.Errorf("export without provenance: got %+v, want it empty", provenance)
+	}
+
+	want := export.Provenance{
+		Commit: "0123456789abcdef",
+		Pages:  map[string]export.PageSource{"Weapon_Laser": {Mod: "BT Advanced Core", Version: "1.2.3"}},
+	}
+	if err := want.Write(filepath.Join(dir, export.ProvenanceFile)); err != nil {
+		t.Fatal(err)
+	}
+	provenance, err = loadProvenance(dir)
+	if err != nil {
+		t.Errorf("got error %s", err)
+	}
+	if !reflect.DeepEqual(provenance, want) {
+		t.Errorf("got provenance %+v, want %+v", provenance, want)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, export.ProvenanceFile), []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadProvenance(dir); err == nil {
+		t.Errorf("broken provenance file loaded without an error")
+	}
+}
+
+func TestImportPagesSummary(t *testing.T) {
+	wiki, opts := newTestWiki(t)
+	setupExistingPages(wiki)
+
+	provenance := export.Provenance{
+		Commit: "0123456789abcdef",
+		Pages: map[string]export.PageSource{
+			"Changed": {Mod: "BT Advanced Core", Version: "1.2.3", Merged: []string{"BTA Lasers"}},
+		},
+	}
+	opts.Summary = "rebalance lasers"
+	opts.ReportOut = filepath.Join(t.TempDir(), "report.json")
+	if err := ImportPages(testExport, provenance, opts); err != nil {
+		t.Fatalf("import failed: %s", err)
+	}
+
+	for title, want := range map[string]string{
+		"RawData:Changed": "automated page update from BT Advanced Core 1.2.3 with merges from BTA Lasers (mods 0123456789ab): rebalance lasers",
+		// pages the provenance does not name still get the commit.
+		"RawData:New": "automated page update (mods 0123456789ab): rebalance lasers",
+	} {
+		page, ok := wiki.Page(title)
+		if !ok {
+			t.Errorf("%s is missing", title)
+			continue
+		}
+		if got := page.Revisions[len(page.Revisions)-1].Summary; got != want {
+			t.Errorf("%s: got revision comment %q, want %q", title, got, want)
+		}
+	}
+}